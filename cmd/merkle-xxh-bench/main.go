@@ -0,0 +1,349 @@
+// Command merkle-xxh-bench compares proof modes by size and verification
+// time across tree sizes and arities, and writes the results as CSV.
+//
+//	merkle-xxh-bench [-sizes N,...] [-arities K,...] [-modes MODE,...]
+//	                 [-samples N] [-batch N] [-xxh128] [-domain-sep] [-seed N]
+//
+// Modes:
+//
+//	proof           one Proof per leaf; arities above 2 build k-ary trees
+//	compressed      one compact Proof per leaf, without the padding
+//	                siblings; its size includes the Omitted bitmap
+//	batch-verifier  batches of individual Proofs checked by a fresh
+//	                Verifier per batch, whose node cache skips the shared
+//	                upper levels. No multi-proof encoding exists, so its
+//	                size is an estimate of one: the union of the batch's
+//	                siblings, less the nodes the batch computes itself
+//
+// Every row reports the bytes of sibling hashes in one proof (proof_bytes),
+// the same per proven leaf (bytes_per_leaf), whether those sizes are
+// estimated rather than measured (bytes_estimated), and the mean
+// verification time per proven leaf.
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	merkletree "github.com/ahm23/go-merkletree-xxh"
+)
+
+// minDuration is how long each measurement repeats its work for.
+const minDuration = 20 * time.Millisecond
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command line and returns the process exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	if err := runBench(args, stdout, stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(stderr, "merkle-xxh-bench:", err)
+		}
+		return 2
+	}
+	return 0
+}
+
+// mode measures one way of proving leaves of a tree.
+type mode func(b *bench) (result, error)
+
+// modeNames lists the modes in the order they are reported.
+var modeNames = []string{"proof", "compressed", "batch-verifier"}
+
+var modes = map[string]mode{
+	"proof":          func(b *bench) (result, error) { return benchProof(b, false) },
+	"compressed":     func(b *bench) (result, error) { return benchProof(b, true) },
+	"batch-verifier": benchBatchVerifier,
+}
+
+// bench is the tree and sampled leaves a mode is measured on.
+type bench struct {
+	config  *merkletree.Config
+	tree    *merkletree.MerkleTree
+	inputs  [][]byte
+	samples []int
+	batch   int
+	rng     *rand.Rand
+}
+
+// result is one CSV row, less the columns describing the tree.
+type result struct {
+	batch        int
+	proofBytes   int
+	bytesPerLeaf float64
+	estimated    bool
+	nsPerLeaf    float64
+}
+
+func runBench(args []string, stdout, stderr io.Writer) error {
+	var (
+		sizes, arities, modeList string
+		samples, batch           int
+		seed                     int64
+		config                   merkletree.Config
+	)
+	fs := flag.NewFlagSet("merkle-xxh-bench", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&sizes, "sizes", "1024,16384,262144", "comma-separated leaf counts")
+	fs.StringVar(&arities, "arities", "2,4,16", "comma-separated tree arities")
+	fs.StringVar(&modeList, "modes", strings.Join(modeNames, ","), "comma-separated proof modes")
+	fs.IntVar(&samples, "samples", 256, "leaves proven per measurement")
+	fs.IntVar(&batch, "batch", 64, "leaves per batch-verifier batch")
+	fs.Int64Var(&seed, "seed", 1, "seed for the generated leaves and samples")
+	fs.BoolVar(&config.XXH128, "xxh128", false, "use 128-bit XXH3 hashing")
+	fs.BoolVar(&config.DomainSeperation, "domain-sep", false, "prefix leaves and nodes to separate their domains")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	if samples <= 0 || batch <= 0 {
+		return errors.New("-samples and -batch must be positive")
+	}
+
+	leafCounts, err := parseInts(sizes)
+	if err != nil {
+		return fmt.Errorf("-sizes: %w", err)
+	}
+	arityList, err := parseInts(arities)
+	if err != nil {
+		return fmt.Errorf("-arities: %w", err)
+	}
+	var selected []string
+	for _, name := range strings.Split(modeList, ",") {
+		if _, ok := modes[name]; !ok {
+			return fmt.Errorf("unknown mode %q", name)
+		}
+		selected = append(selected, name)
+	}
+
+	w := csv.NewWriter(stdout)
+	_ = w.Write([]string{"mode", "leaves", "arity", "hash_bits", "batch", "proof_bytes", "bytes_per_leaf", "bytes_estimated", "verify_ns_per_leaf"})
+
+	hashBits := "64"
+	if config.XXH128 {
+		hashBits = "128"
+	}
+	for _, n := range leafCounts {
+		rng := rand.New(rand.NewSource(seed))
+		inputs := make([][]byte, n)
+		for i := range inputs {
+			inputs[i] = make([]byte, 32)
+			rng.Read(inputs[i])
+		}
+
+		for _, arity := range arityList {
+			cfg := config
+			cfg.Arity = arity
+			tree, err := merkletree.New(&cfg, inputs)
+			if err != nil {
+				return fmt.Errorf("building %d leaves with arity %d: %w", n, arity, err)
+			}
+			b := &bench{
+				config:  &cfg,
+				tree:    tree,
+				inputs:  inputs,
+				samples: sample(rng, n, samples),
+				batch:   min(batch, n),
+				rng:     rng,
+			}
+
+			for _, name := range selected {
+				res, err := modes[name](b)
+				if err != nil {
+					return fmt.Errorf("%s with %d leaves and arity %d: %w", name, n, arity, err)
+				}
+				_ = w.Write([]string{
+					name,
+					strconv.Itoa(n),
+					strconv.Itoa(arity),
+					hashBits,
+					strconv.Itoa(res.batch),
+					strconv.Itoa(res.proofBytes),
+					strconv.FormatFloat(res.bytesPerLeaf, 'f', 1, 64),
+					strconv.FormatBool(res.estimated),
+					strconv.FormatFloat(res.nsPerLeaf, 'f', 1, 64),
+				})
+			}
+			w.Flush()
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// benchProof measures individual proofs of the sampled leaves, compacted if
+// compact is set.
+func benchProof(b *bench, compact bool) (result, error) {
+	proofs := make([]*merkletree.Proof, len(b.samples))
+	size := 0
+	for i, leaf := range b.samples {
+		proof, err := b.tree.Proof(leaf)
+		if err != nil {
+			return result{}, err
+		}
+		if compact {
+			proof = proof.Compact()
+		}
+		proofs[i] = proof
+		size += siblingBytes(proof) + len(proof.Omitted)
+	}
+
+	ns, err := measure(len(proofs), func() error {
+		for i, leaf := range b.samples {
+			ok, err := merkletree.Verify(b.inputs[leaf], b.tree.Root, proofs[i], b.config)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("proof of leaf %d does not verify", leaf)
+			}
+		}
+		return nil
+	})
+
+	perLeaf := float64(size) / float64(len(proofs))
+	return result{batch: 1, proofBytes: int(perLeaf), bytesPerLeaf: perLeaf, nsPerLeaf: ns}, err
+}
+
+// benchBatchVerifier measures random batches of leaves verified together,
+// against the estimated size of a multi-proof of each batch.
+func benchBatchVerifier(b *bench) (result, error) {
+	batches := max(len(b.samples)/b.batch, 1)
+	var (
+		size    int
+		inputs  = make([][][]byte, batches)
+		proofs  = make([][]*merkletree.Proof, batches)
+		arity   = b.tree.Config.Arity
+		width   = len(b.tree.Root)
+		leaves  = b.tree.LeafCount
+		proven  = 0
+		indices []int
+	)
+	for i := range proofs {
+		indices = sample(b.rng, leaves, b.batch)
+		size += multiProofSiblings(leaves, max(arity, 2), indices) * width
+		for _, leaf := range indices {
+			proof, err := b.tree.Proof(leaf)
+			if err != nil {
+				return result{}, err
+			}
+			inputs[i] = append(inputs[i], b.inputs[leaf])
+			proofs[i] = append(proofs[i], proof)
+		}
+		proven += len(indices)
+	}
+
+	ns, err := measure(proven, func() error {
+		for i := range proofs {
+			v := merkletree.NewVerifier(b.tree.Root, b.config)
+			v.Parallelism = 1
+			results, err := v.VerifyBatch(inputs[i], proofs[i])
+			if err != nil {
+				return err
+			}
+			for j, ok := range results {
+				if !ok {
+					return fmt.Errorf("proof %d of batch %d does not verify", j, i)
+				}
+			}
+		}
+		return nil
+	})
+
+	return result{
+		batch:        b.batch,
+		proofBytes:   size / batches,
+		bytesPerLeaf: float64(size) / float64(proven),
+		estimated:    true,
+		nsPerLeaf:    ns,
+	}, err
+}
+
+// multiProofSiblings counts the distinct nodes a hypothetical multi-proof of the given
+// leaves must carry: the siblings of every path that are not themselves on
+// one of the paths. Siblings past the end of a level are padding copies of
+// its last node.
+func multiProofSiblings(leafCount, arity int, indices []int) int {
+	known := make(map[int]bool, len(indices))
+	for _, i := range indices {
+		known[i] = true
+	}
+
+	count, siblings := leafCount, 0
+	for count > 1 {
+		needed := make(map[int]bool)
+		parents := make(map[int]bool, len(known))
+		for i := range known {
+			first := i - i%arity
+			for j := first; j < first+arity; j++ {
+				node := min(j, count-1)
+				if !known[node] {
+					needed[node] = true
+				}
+			}
+			parents[i/arity] = true
+		}
+		siblings += len(needed)
+		known = parents
+		count = (count + arity - 1) / arity
+	}
+	return siblings
+}
+
+func siblingBytes(proof *merkletree.Proof) int {
+	size := 0
+	for _, sib := range proof.Siblings {
+		size += len(sib)
+	}
+	return size
+}
+
+// measure repeats fn until minDuration has passed and returns the mean time
+// per item, fn processing items items per call.
+func measure(items int, fn func() error) (float64, error) {
+	var (
+		calls   int
+		elapsed time.Duration
+	)
+	for elapsed < minDuration {
+		start := time.Now()
+		if err := fn(); err != nil {
+			return 0, err
+		}
+		elapsed += time.Since(start)
+		calls++
+	}
+	return float64(elapsed.Nanoseconds()) / float64(calls*items), nil
+}
+
+// sample returns up to count distinct leaf indices below n.
+func sample(rng *rand.Rand, n, count int) []int {
+	if count >= n {
+		return rng.Perm(n)
+	}
+	return rng.Perm(n)[:count]
+}
+
+func parseInts(list string) ([]int, error) {
+	var out []int
+	for _, field := range strings.Split(list, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
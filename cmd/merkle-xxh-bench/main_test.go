@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runBenchCLI(t *testing.T, args ...string) [][]string {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	rows, err := csv.NewReader(&stdout).ReadAll()
+	require.NoError(t, err)
+	return rows
+}
+
+func TestRun(t *testing.T) {
+	t.Run("writes a row per size, arity and mode", func(t *testing.T) {
+		rows := runBenchCLI(t, "-sizes", "16,100", "-arities", "2,4", "-samples", "8", "-batch", "4")
+		require.Len(t, rows, 1+2*2*3)
+		assert.Equal(t, []string{"mode", "leaves", "arity", "hash_bits", "batch", "proof_bytes", "bytes_per_leaf", "bytes_estimated", "verify_ns_per_leaf"}, rows[0])
+
+		byKey := make(map[string][]string)
+		for _, row := range rows[1:] {
+			byKey[row[0]+"/"+row[1]+"/"+row[2]] = row
+		}
+
+		// 16 leaves: 4 binary levels or 2 quaternary levels of 3 siblings.
+		assert.Equal(t, "32", byKey["proof/16/2"][5])
+		assert.Equal(t, "48", byKey["proof/16/4"][5])
+		assert.Equal(t, "4", byKey["batch-verifier/16/2"][4])
+		assert.Equal(t, "true", byKey["batch-verifier/16/2"][7])
+		assert.Equal(t, "false", byKey["proof/16/2"][7])
+
+		// Every leaf of a full tree needs all of its siblings.
+		assert.Equal(t, byKey["proof/16/2"][5], byKey["compressed/16/2"][5])
+
+		for key, row := range byKey {
+			if row[0] != "batch-verifier" {
+				continue
+			}
+			single := byKey["proof/"+row[1]+"/"+row[2]]
+			multi, err := strconv.ParseFloat(row[6], 64)
+			require.NoError(t, err)
+			perProof, err := strconv.ParseFloat(single[6], 64)
+			require.NoError(t, err)
+			assert.Less(t, multi, perProof, key)
+		}
+	})
+
+	t.Run("selects modes and hash width", func(t *testing.T) {
+		rows := runBenchCLI(t, "-sizes", "8", "-arities", "2", "-modes", "proof", "-xxh128", "-samples", "4")
+		require.Len(t, rows, 2)
+		assert.Equal(t, []string{"proof", "8", "2", "128", "1", "48"}, rows[1][:6])
+	})
+
+	t.Run("rejects bad flags", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"-modes", "verkle"},
+			{"-modes", "proof,"},
+			{"-sizes", "many"},
+			{"-arities", "1", "-sizes", "8"},
+			{"-batch", "0"},
+			{"extra"},
+		} {
+			var stdout, stderr bytes.Buffer
+			assert.Equal(t, 2, run(args, &stdout, &stderr), "%v", args)
+			assert.NotEmpty(t, stderr.String())
+		}
+	})
+}
+
+func TestMultiProofSiblings(t *testing.T) {
+	// One leaf needs its whole path.
+	assert.Equal(t, 3, multiProofSiblings(8, 2, []int{5}))
+	// Two sibling leaves share everything above them.
+	assert.Equal(t, 2, multiProofSiblings(8, 2, []int{4, 5}))
+	// Every leaf: nothing to carry.
+	assert.Equal(t, 0, multiProofSiblings(4, 2, []int{0, 1, 2, 3}))
+	// Padding copies of nodes on the path are never carried.
+	assert.Equal(t, 1, multiProofSiblings(5, 2, []int{4}))
+	// Quaternary: three siblings at each of two levels.
+	assert.Equal(t, 6, multiProofSiblings(16, 4, []int{0}))
+}
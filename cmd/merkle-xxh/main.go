@@ -0,0 +1,248 @@
+// Command merkle-xxh builds xxh3 Merkle trees over files, lines of stdin or
+// fixed-size chunks, prints their root, and generates and verifies proofs.
+//
+//	merkle-xxh root   [flags] [file ...]
+//	merkle-xxh proof  [flags] (-index N | -input DATA) [file ...]
+//	merkle-xxh verify [flags] -root HEX -proof FILE (-input DATA | -input-file FILE)
+//
+// By default every file is one leaf. With -lines each line of stdin is a
+// leaf, and with -chunk N the files are split into N-byte chunks.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	merkletree "github.com/ahm23/go-merkletree-xxh"
+)
+
+const usage = `usage:
+  merkle-xxh root   [flags] [file ...]
+  merkle-xxh proof  [flags] (-index N | -input DATA) [file ...]
+  merkle-xxh verify [flags] -root HEX -proof FILE (-input DATA | -input-file FILE)
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command line and returns the process exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "root":
+		err = runRoot(args[1:], stdin, stdout)
+	case "proof":
+		err = runProof(args[1:], stdin, stdout)
+	case "verify":
+		var ok bool
+		if ok, err = runVerify(args[1:], stdout); err == nil && !ok {
+			return 1
+		}
+	default:
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(stderr, "merkle-xxh:", err)
+		}
+		return 2
+	}
+	return 0
+}
+
+// options holds the flags shared by every command.
+type options struct {
+	xxh128    bool
+	domainSep bool
+	lines     bool
+	chunk     int
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	o.registerHash(fs)
+	fs.BoolVar(&o.lines, "lines", false, "use each line of stdin as a leaf")
+	fs.IntVar(&o.chunk, "chunk", 0, "split the files into chunks of this many bytes")
+}
+
+// registerHash registers the flags that mirror Config.
+func (o *options) registerHash(fs *flag.FlagSet) {
+	fs.BoolVar(&o.xxh128, "xxh128", false, "use 128-bit XXH3 hashing")
+	fs.BoolVar(&o.domainSep, "domain-sep", false, "prefix leaves and nodes to separate their domains")
+}
+
+func (o *options) config() *merkletree.Config {
+	return &merkletree.Config{XXH128: o.xxh128, DomainSeperation: o.domainSep}
+}
+
+// leaves reads the leaf inputs selected by the options.
+func (o *options) leaves(files []string, stdin io.Reader) ([][]byte, error) {
+	if o.lines {
+		if len(files) != 0 {
+			return nil, errors.New("-lines reads stdin and takes no files")
+		}
+		var leaves [][]byte
+		scanner := bufio.NewScanner(stdin)
+		scanner.Buffer(nil, 1<<30)
+		for scanner.Scan() {
+			leaves = append(leaves, append([]byte(nil), scanner.Bytes()...))
+		}
+		return leaves, scanner.Err()
+	}
+
+	if len(files) == 0 {
+		return nil, errors.New("no input files")
+	}
+	var leaves [][]byte
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		if o.chunk <= 0 {
+			leaves = append(leaves, data)
+			continue
+		}
+		for len(data) > o.chunk {
+			leaves = append(leaves, data[:o.chunk:o.chunk])
+			data = data[o.chunk:]
+		}
+		leaves = append(leaves, data)
+	}
+	return leaves, nil
+}
+
+// build parses the flags and builds the tree over the selected inputs.
+func (o *options) build(fs *flag.FlagSet, args []string, stdin io.Reader) (*merkletree.MerkleTree, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	leaves, err := o.leaves(fs.Args(), stdin)
+	if err != nil {
+		return nil, err
+	}
+	return merkletree.New(o.config(), leaves)
+}
+
+func runRoot(args []string, stdin io.Reader, stdout io.Writer) error {
+	var opts options
+	fs := flag.NewFlagSet("root", flag.ContinueOnError)
+	opts.register(fs)
+
+	tree, err := opts.build(fs, args, stdin)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, tree.Root)
+	return err
+}
+
+func runProof(args []string, stdin io.Reader, stdout io.Writer) error {
+	var (
+		opts    options
+		index   int
+		input   string
+		compact bool
+	)
+	fs := flag.NewFlagSet("proof", flag.ContinueOnError)
+	opts.register(fs)
+	fs.IntVar(&index, "index", -1, "index of the leaf to prove")
+	fs.StringVar(&input, "input", "", "leaf data to prove")
+	fs.BoolVar(&compact, "compact", false, "omit siblings that are padding copies")
+
+	tree, err := opts.build(fs, args, stdin)
+	if err != nil {
+		return err
+	}
+
+	var proof *merkletree.Proof
+	switch {
+	case index >= 0 && input != "":
+		return errors.New("-index and -input are mutually exclusive")
+	case index >= 0:
+		proof, err = tree.Proof(index)
+	case input != "":
+		proof, err = tree.ProofFromInput([]byte(input))
+	default:
+		return errors.New("one of -index or -input is required")
+	}
+	if err != nil {
+		return err
+	}
+	if compact {
+		proof = proof.Compact()
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(proof)
+}
+
+func runVerify(args []string, stdout io.Writer) (bool, error) {
+	var (
+		opts      options
+		rootHex   string
+		proofPath string
+		input     string
+		inputPath string
+	)
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	opts.registerHash(fs)
+	fs.StringVar(&rootHex, "root", "", "hex-encoded root to verify against")
+	fs.StringVar(&proofPath, "proof", "", "proof file written by the proof command")
+	fs.StringVar(&input, "input", "", "leaf data to verify")
+	fs.StringVar(&inputPath, "input-file", "", "file holding the leaf data to verify")
+	if err := fs.Parse(args); err != nil {
+		return false, err
+	}
+
+	var root merkletree.Root
+	if err := root.UnmarshalText([]byte(rootHex)); err != nil || len(root) == 0 {
+		return false, errors.New("-root must be a hex-encoded root")
+	}
+
+	var err error
+	data := []byte(input)
+	switch {
+	case input != "" && inputPath != "":
+		return false, errors.New("-input and -input-file are mutually exclusive")
+	case inputPath != "":
+		if data, err = os.ReadFile(inputPath); err != nil {
+			return false, err
+		}
+	case input == "":
+		return false, errors.New("one of -input or -input-file is required")
+	}
+
+	raw, err := os.ReadFile(proofPath)
+	if err != nil {
+		return false, err
+	}
+	proof := new(merkletree.Proof)
+	if err := json.Unmarshal(raw, proof); err != nil {
+		return false, fmt.Errorf("reading proof: %w", err)
+	}
+
+	ok, err := merkletree.Verify(data, root, proof, opts.config())
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		fmt.Fprintln(stdout, "OK")
+	} else {
+		fmt.Fprintln(stdout, "FAIL")
+	}
+	return ok, nil
+}
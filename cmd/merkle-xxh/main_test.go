@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	merkletree "github.com/ahm23/go-merkletree-xxh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runCLI runs the command line and returns its exit code and output.
+func runCLI(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func writeFiles(t *testing.T, contents ...string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	paths := make([]string, len(contents))
+	for i, c := range contents {
+		paths[i] = filepath.Join(dir, string(rune('a'+i)))
+		require.NoError(t, os.WriteFile(paths[i], []byte(c), 0o600))
+	}
+	return paths
+}
+
+func TestRoot(t *testing.T) {
+	t.Run("one leaf per file", func(t *testing.T) {
+		files := writeFiles(t, "alpha", "beta", "gamma")
+		code, out, _ := runCLI(t, "", append([]string{"root", "--xxh128", "--domain-sep"}, files...)...)
+		require.Equal(t, 0, code)
+
+		tree, err := merkletree.New(&merkletree.Config{XXH128: true, DomainSeperation: true},
+			[][]byte{[]byte("alpha"), []byte("beta"), []byte("gamma")})
+		require.NoError(t, err)
+		assert.Equal(t, hex.EncodeToString(tree.Root)+"\n", out)
+	})
+
+	t.Run("lines of stdin", func(t *testing.T) {
+		code, out, _ := runCLI(t, "one\ntwo\nthree\n", "root", "-lines")
+		require.Equal(t, 0, code)
+
+		tree, err := merkletree.New(nil, [][]byte{[]byte("one"), []byte("two"), []byte("three")})
+		require.NoError(t, err)
+		assert.Equal(t, hex.EncodeToString(tree.Root)+"\n", out)
+	})
+
+	t.Run("fixed-size chunks", func(t *testing.T) {
+		files := writeFiles(t, "0123456789")
+		code, out, _ := runCLI(t, "", "root", "-chunk", "4", files[0])
+		require.Equal(t, 0, code)
+
+		tree, err := merkletree.New(nil, [][]byte{[]byte("0123"), []byte("4567"), []byte("89")})
+		require.NoError(t, err)
+		assert.Equal(t, hex.EncodeToString(tree.Root)+"\n", out)
+	})
+
+	t.Run("reports errors", func(t *testing.T) {
+		code, _, stderr := runCLI(t, "only\n", "root", "-lines")
+		assert.Equal(t, 2, code)
+		assert.Contains(t, stderr, merkletree.ErrInvalidNumOfLeaves.Error())
+
+		code, _, _ = runCLI(t, "", "bogus")
+		assert.Equal(t, 2, code)
+	})
+}
+
+func TestProofAndVerify(t *testing.T) {
+	files := writeFiles(t, "alpha", "beta", "gamma", "delta", "epsilon")
+	dir := t.TempDir()
+
+	code, rootOut, _ := runCLI(t, "", append([]string{"root", "--domain-sep"}, files...)...)
+	require.Equal(t, 0, code)
+	root := strings.TrimSpace(rootOut)
+
+	for _, selector := range [][]string{{"-index", "4"}, {"-input", "epsilon"}} {
+		args := append(append([]string{"proof", "--domain-sep"}, selector...), files...)
+		code, proofOut, stderr := runCLI(t, "", args...)
+		require.Equal(t, 0, code, stderr)
+
+		proofPath := filepath.Join(dir, "proof.json")
+		require.NoError(t, os.WriteFile(proofPath, []byte(proofOut), 0o600))
+
+		code, out, _ := runCLI(t, "", "verify", "--domain-sep", "-root", root, "-proof", proofPath, "-input", "epsilon")
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "OK\n", out)
+
+		code, out, _ = runCLI(t, "", "verify", "--domain-sep", "-root", root, "-proof", proofPath, "-input-file", files[4])
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "OK\n", out)
+
+		code, out, _ = runCLI(t, "", "verify", "--domain-sep", "-root", root, "-proof", proofPath, "-input", "alpha")
+		assert.Equal(t, 1, code)
+		assert.Equal(t, "FAIL\n", out)
+	}
+
+	code, _, stderr := runCLI(t, "", append([]string{"proof", "-input", "missing"}, files...)...)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, merkletree.ErrProofInvalidLeaf.Error())
+}
+
+func TestCompactProof(t *testing.T) {
+	files := writeFiles(t, "alpha", "beta", "gamma", "delta", "epsilon")
+	code, rootOut, _ := runCLI(t, "", append([]string{"root"}, files...)...)
+	require.Equal(t, 0, code)
+
+	code, proofOut, stderr := runCLI(t, "", append([]string{"proof", "-compact", "-index", "4"}, files...)...)
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, proofOut, `"omitted"`)
+
+	proofPath := filepath.Join(t.TempDir(), "proof.json")
+	require.NoError(t, os.WriteFile(proofPath, []byte(proofOut), 0o600))
+	code, out, _ := runCLI(t, "", "verify", "-root", strings.TrimSpace(rootOut), "-proof", proofPath, "-input", "epsilon")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "OK\n", out)
+}
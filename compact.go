@@ -0,0 +1,114 @@
+package merkletree
+
+import "math/bits"
+
+// Compact returns a copy of the proof without the siblings that are padding
+// copies of the child before them, marking each one in Omitted instead. For a
+// binary tree these are the copies of the proven node on the right edge of
+// the tree. Verification fills them back in, so a compact proof verifies
+// exactly like the full one. The copy shares sibling hashes with p. Proofs
+// that do not record their leaf count, or are already compact, are copied
+// unchanged.
+func (p *Proof) Compact() *Proof {
+	c := *p
+	if p.LeafCount <= 0 || p.LeafCount > maxLeafCount || len(p.Omitted) != 0 {
+		c.Siblings = append([][]byte(nil), p.Siblings...)
+		return &c
+	}
+
+	k := p.Config().arity()
+	c.Siblings = make([][]byte, 0, len(p.Siblings))
+	omitted := make([]byte, (len(p.Siblings)+7)/8)
+
+	index := int(p.Index)
+	for i, sib := range p.Siblings {
+		level, j := i/(k-1), i%(k-1)
+		if j == 0 && level > 0 {
+			index /= k
+		}
+		pos := index % k
+		child := j
+		if j >= pos {
+			child++
+		}
+		if index-pos+child >= levelCount(p.LeafCount, level, k) {
+			omitted[i/8] |= 1 << (i % 8)
+			continue
+		}
+		c.Siblings = append(c.Siblings, sib)
+	}
+
+	if len(c.Siblings) < len(p.Siblings) {
+		c.Omitted = omitted
+	}
+	return &c
+}
+
+// siblingCount returns the number of siblings of the full proof, counting
+// omitted ones.
+func (p *Proof) siblingCount() int {
+	n := len(p.Siblings)
+	for _, b := range p.Omitted {
+		n += bits.OnesCount8(b)
+	}
+	return n
+}
+
+// omitted reports whether sibling i of the full proof is omitted.
+func (p *Proof) omitted(i int) bool {
+	return i/8 < len(p.Omitted) && p.Omitted[i/8]&(1<<(i%8)) != 0
+}
+
+// checkOmitted reports whether the Omitted bitmap covers exactly the full
+// proof and only omits siblings that have a child before them.
+func (p *Proof) checkOmitted(arity int) bool {
+	if len(p.Omitted) == 0 {
+		return true
+	}
+	total := p.siblingCount()
+	if len(p.Omitted) != (total+7)/8 {
+		return false
+	}
+	if last := p.Omitted[len(p.Omitted)-1]; total%8 != 0 && last>>(total%8) != 0 {
+		return false
+	}
+
+	index := p.Index
+	for i := 0; i < total; i += arity - 1 {
+		// The first sibling only follows another child if the node is
+		// the first child.
+		if p.omitted(i) && index%uint64(arity) != 0 {
+			return false
+		}
+		index /= uint64(arity)
+	}
+	return true
+}
+
+// levelSiblings returns the arity-1 siblings of the node at a level of the
+// path, whose position among its siblings is pos. Siblings are taken from
+// p.Siblings starting at *next, and omitted ones are copied from the child
+// before them. buf is reused to hold the siblings of compact proofs.
+func (p *Proof) levelSiblings(buf [][]byte, level, arity, pos int, node []byte, next *int) [][]byte {
+	if len(p.Omitted) == 0 {
+		return p.Siblings[level*(arity-1) : (level+1)*(arity-1)]
+	}
+
+	if buf == nil {
+		buf = make([][]byte, 0, arity-1)
+	}
+	buf = buf[:0]
+	for j := 0; j < arity-1; j++ {
+		switch {
+		case !p.omitted(level*(arity-1) + j):
+			buf = append(buf, p.Siblings[*next])
+			*next++
+		case j == pos:
+			// the child before this sibling is the node itself
+			buf = append(buf, node)
+		default:
+			buf = append(buf, buf[j-1])
+		}
+	}
+	return buf
+}
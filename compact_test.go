@@ -0,0 +1,117 @@
+package merkletree
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProof_Compact(t *testing.T) {
+	t.Parallel()
+
+	t.Run("verifies like the full proof", func(t *testing.T) {
+		for _, cfg := range []*Config{
+			{},
+			{DomainSeperation: true},
+			{XXH128: true, SealRoot: true},
+			{Arity: 3},
+			{Arity: 4, DomainSeperation: true, SealRoot: true},
+			{Arity: 16},
+		} {
+			for _, n := range []int{2, 5, 7, 13, 33} {
+				input := generateRandomInputs(t, n)
+				tree, err := New(cfg, input)
+				require.NoError(t, err)
+				v := NewVerifier(tree.Root, cfg)
+
+				for i, proof := range allProofs(t, tree) {
+					compact := proof.Compact()
+					assert.LessOrEqual(t, len(compact.Siblings), len(proof.Siblings))
+
+					ok, err := Verify(input[i], tree.Root, compact, cfg)
+					require.NoError(t, err)
+					assert.True(t, ok, "arity %d, %d leaves, leaf %d", cfg.Arity, n, i)
+
+					ok, err = v.Verify(input[i], compact)
+					require.NoError(t, err)
+					assert.True(t, ok, "verifier: arity %d, %d leaves, leaf %d", cfg.Arity, n, i)
+
+					ok, err = Verify(input[(i+1)%n], tree.Root, compact, cfg)
+					require.NoError(t, err)
+					assert.False(t, ok)
+				}
+			}
+		}
+	})
+
+	t.Run("omits the odd node's copies", func(t *testing.T) {
+		input := generateRandomInputs(t, 5)
+		tree, err := New(nil, input)
+		require.NoError(t, err)
+
+		proof, err := tree.Proof(4)
+		require.NoError(t, err)
+		compact := proof.Compact()
+		// Leaf 4 and its parent are the odd nodes of their levels.
+		assert.Equal(t, []byte{0b011}, compact.Omitted)
+		assert.Equal(t, proof.Siblings[2:], compact.Siblings)
+
+		proof, err = tree.Proof(1)
+		require.NoError(t, err)
+		compact = proof.Compact()
+		assert.Nil(t, compact.Omitted)
+		assert.Equal(t, proof.Siblings, compact.Siblings)
+	})
+
+	t.Run("survives JSON", func(t *testing.T) {
+		input := generateRandomInputs(t, 9)
+		tree, err := New(&Config{DomainSeperation: true}, input)
+		require.NoError(t, err)
+
+		proof, err := tree.Proof(8)
+		require.NoError(t, err)
+		data, err := json.Marshal(proof.Compact())
+		require.NoError(t, err)
+
+		var decoded Proof
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		assert.NotEmpty(t, decoded.Omitted)
+		ok, err := Verify(input[8], tree.Root, &decoded, nil)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("rejects malformed bitmaps", func(t *testing.T) {
+		input := generateRandomInputs(t, 5)
+		tree, err := New(nil, input)
+		require.NoError(t, err)
+		proof, err := tree.Proof(4)
+		require.NoError(t, err)
+
+		for name, omitted := range map[string][]byte{
+			"bit past the end":   {0b10011},
+			"too long":           {0b011, 0},
+			"no child before it": {0b111},
+		} {
+			bad := proof.Compact()
+			bad.Omitted = omitted
+			_, err := Verify(input[4], tree.Root, bad, nil)
+			assert.ErrorIs(t, err, ErrInvalidOmitted, name)
+
+			res, err := VerifyDetailed(input[4], tree.Root, bad, nil)
+			require.NoError(t, err)
+			assert.Equal(t, VerifySiblingLength, res.Reason, name)
+		}
+
+		// Omitting a sibling that is not a copy only changes the root.
+		odd, err := tree.Proof(2)
+		require.NoError(t, err)
+		bad := odd.Compact()
+		bad.Omitted, bad.Siblings = []byte{0b001}, bad.Siblings[1:]
+		ok, err := Verify(input[2], tree.Root, bad, nil)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+}
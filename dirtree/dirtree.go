@@ -0,0 +1,364 @@
+// Package dirtree fingerprints directory trees as a Merkle DAG built from
+// xxh3 Merkle trees.
+//
+// Every regular file gets a chunk tree over a size header followed by its
+// fixed-size chunks; its root is the file's content root. Every directory gets
+// a tree over a header followed by one leaf per child entry (name, mode, size
+// and content root), with children sorted by name. A symbolic link's content
+// is its target. The root of the top directory's tree fingerprints the whole
+// tree, and a change to any file only alters the roots on its path.
+package dirtree
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	merkletree "github.com/ahm23/go-merkletree-xxh"
+)
+
+// DefaultChunkSize is the chunk size used when Options.ChunkSize is zero.
+const DefaultChunkSize = 1 << 20
+
+var (
+	ErrUnsupportedFile = errors.New("dirtree: unsupported file type")
+	ErrNotFound        = errors.New("dirtree: no such entry")
+	ErrProofMismatch   = errors.New("dirtree: proof does not match path")
+	ErrFileChanged     = errors.New("dirtree: file changed while hashing")
+)
+
+// Entry kinds encoded in directory leaves.
+const (
+	kindFile byte = iota
+	kindDir
+	kindSymlink
+)
+
+// Options configure how a directory tree is hashed.
+type Options struct {
+	// Config used for every chunk and directory tree.
+	Config *merkletree.Config
+	// Size of the chunks files are split into. Defaults to DefaultChunkSize.
+	ChunkSize int
+}
+
+// Entry describes a file, directory or symbolic link as committed to by its
+// parent directory's tree.
+type Entry struct {
+	Name        string
+	Mode        fs.FileMode
+	Size        int64
+	ContentRoot []byte
+}
+
+// Tree is the Merkle DAG of a directory.
+type Tree struct {
+	// Root of the top directory's tree.
+	Root []byte
+
+	config *merkletree.Config
+	top    *dir
+}
+
+// dir keeps a directory's tree and entries so that inclusion can be proven.
+type dir struct {
+	tree    *merkletree.MerkleTree
+	entries []Entry
+	subdirs map[string]*dir
+}
+
+// Hash walks the directory at root and builds its Merkle DAG.
+func Hash(root string, opts *Options) (*Tree, error) {
+	if opts == nil {
+		opts = new(Options)
+	}
+	config := opts.Config
+	if config == nil {
+		config = new(merkletree.Config)
+	}
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	h := &hasher{config: config, buf: make([]byte, chunkSize)}
+	top, err := h.hashDir(root)
+	if err != nil {
+		return nil, err
+	}
+	return &Tree{Root: top.tree.Root, config: config, top: top}, nil
+}
+
+type hasher struct {
+	config *merkletree.Config
+	// buf holds the chunk being hashed; every file is read through it.
+	buf []byte
+}
+
+func (h *hasher) hashDir(name string) (*dir, error) {
+	children, err := os.ReadDir(name) // sorted by name
+	if err != nil {
+		return nil, err
+	}
+
+	d := &dir{subdirs: make(map[string]*dir)}
+	for _, child := range children {
+		childPath := filepath.Join(name, child.Name())
+		info, err := os.Lstat(childPath)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := Entry{Name: child.Name(), Mode: info.Mode()}
+		switch {
+		case info.Mode().IsRegular():
+			entry.Size = info.Size()
+			if entry.ContentRoot, err = h.hashFile(childPath, entry.Size); err != nil {
+				return nil, err
+			}
+		case info.IsDir():
+			sub, err := h.hashDir(childPath)
+			if err != nil {
+				return nil, err
+			}
+			entry.ContentRoot = sub.tree.Root
+			d.subdirs[entry.Name] = sub
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(childPath)
+			if err != nil {
+				return nil, err
+			}
+			entry.Size = int64(len(target))
+			src := merkletree.SliceSource([][]byte{fileHeader(entry.Size), []byte(target)})
+			root, err := merkletree.RootFrom(context.Background(), h.config, src)
+			if err != nil {
+				return nil, err
+			}
+			entry.ContentRoot = root
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedFile, childPath)
+		}
+		d.entries = append(d.entries, entry)
+	}
+
+	leaves := make([][]byte, 0, len(d.entries)+2)
+	leaves = append(leaves, binary.LittleEndian.AppendUint64([]byte{kindDir}, uint64(len(d.entries))))
+	for _, entry := range d.entries {
+		leaves = append(leaves, encodeEntry(entry))
+	}
+	if len(d.entries) == 0 {
+		leaves = append(leaves, nil) // trees need at least two leaves
+	}
+
+	if d.tree, err = merkletree.New(h.config, leaves); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// hashFile builds the chunk tree of a file of the given size, hashing each
+// chunk as it is read.
+func (h *hasher) hashFile(name string, size int64) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	src := &fileSource{r: f, buf: h.buf, size: size}
+	root, err := merkletree.RootFrom(context.Background(), h.config, src)
+	if err != nil {
+		if errors.Is(err, ErrFileChanged) {
+			return nil, fmt.Errorf("%w: %s", err, name)
+		}
+		return nil, err
+	}
+	return root, nil
+}
+
+// fileHeader is the first leaf of a chunk tree, committing to the file size.
+func fileHeader(size int64) []byte {
+	return binary.LittleEndian.AppendUint64([]byte{kindFile}, uint64(size))
+}
+
+// fileSource yields the leaves of a file's chunk tree: its header, then its
+// chunks read into buf. An empty file is one empty chunk.
+type fileSource struct {
+	r    io.Reader
+	buf  []byte
+	size int64
+	read int64
+	// leaves counts the leaves returned, header included.
+	leaves int
+}
+
+func (s *fileSource) Next() ([]byte, error) {
+	if s.leaves == 0 {
+		s.leaves++
+		return fileHeader(s.size), nil
+	}
+
+	n, err := io.ReadFull(s.r, s.buf)
+	s.read += int64(n)
+	switch {
+	case s.read > s.size:
+		return nil, ErrFileChanged
+	case n > 0:
+		s.leaves++
+		return s.buf[:n], nil
+	case err != io.EOF:
+		return nil, err
+	case s.read != s.size:
+		return nil, ErrFileChanged
+	case s.leaves == 1:
+		s.leaves++
+		return nil, nil
+	}
+	return nil, io.EOF
+}
+
+// encodeEntry encodes a directory entry as a leaf.
+func encodeEntry(e Entry) []byte {
+	kind := kindFile
+	switch {
+	case e.Mode.IsDir():
+		kind = kindDir
+	case e.Mode&fs.ModeSymlink != 0:
+		kind = kindSymlink
+	}
+
+	buf := make([]byte, 0, 1+4+8+4+len(e.Name)+len(e.ContentRoot))
+	buf = append(buf, kind)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(e.Mode))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(e.Size))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(e.Name)))
+	buf = append(buf, e.Name...)
+	return append(buf, e.ContentRoot...)
+}
+
+// Lookup returns the entry at a slash-separated path relative to the root.
+func (t *Tree) Lookup(name string) (Entry, error) {
+	d, i, err := t.find(name)
+	if err != nil {
+		return Entry{}, err
+	}
+	return d.entries[i], nil
+}
+
+// find resolves a path to its parent directory and the entry's position in it.
+func (t *Tree) find(name string) (*dir, int, error) {
+	parts := strings.Split(path.Clean(name), "/")
+	d := t.top
+	for k, part := range parts {
+		i, ok := d.index(part)
+		if !ok {
+			return nil, 0, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		if k == len(parts)-1 {
+			return d, i, nil
+		}
+		if d = d.subdirs[part]; d == nil {
+			return nil, 0, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+	}
+	return nil, 0, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// index finds a child entry by name using the sorted order of entries.
+func (d *dir) index(name string) (int, bool) {
+	lo, hi := 0, len(d.entries)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if d.entries[mid].Name < name {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, lo < len(d.entries) && d.entries[lo].Name == name
+}
+
+// PathProof proves that an entry is included at a path. Steps run from the
+// entry itself up to the top directory.
+type PathProof struct {
+	Steps []Step
+}
+
+// Step proves that Entry is a child of the directory one level up.
+type Step struct {
+	Entry Entry
+	Proof *merkletree.Proof
+}
+
+// Prove generates a proof that the entry at a slash-separated path, with its
+// current content root, is included in the tree.
+func (t *Tree) Prove(name string) (*PathProof, error) {
+	parts := strings.Split(path.Clean(name), "/")
+	steps := make([]Step, len(parts))
+
+	d := t.top
+	for k, part := range parts {
+		i, ok := d.index(part)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		proof, err := d.tree.Proof(i + 1) // leaf 0 is the directory header
+		if err != nil {
+			return nil, err
+		}
+		steps[len(parts)-1-k] = Step{Entry: d.entries[i], Proof: proof}
+
+		if k < len(parts)-1 {
+			if d = d.subdirs[part]; d == nil {
+				return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+			}
+		}
+	}
+	return &PathProof{Steps: steps}, nil
+}
+
+// VerifyPath checks that the entry at a slash-separated path has the given
+// content root and is included in the tree with the given root.
+func VerifyPath(root []byte, name string, contentRoot []byte, proof *PathProof, config *merkletree.Config) (bool, error) {
+	if proof == nil {
+		return false, merkletree.ErrProofIsNil
+	}
+
+	parts := strings.Split(path.Clean(name), "/")
+	if len(proof.Steps) != len(parts) {
+		return false, ErrProofMismatch
+	}
+	for k, step := range proof.Steps {
+		if step.Entry.Name != parts[len(parts)-1-k] {
+			return false, ErrProofMismatch
+		}
+	}
+	if !bytes.Equal(proof.Steps[0].Entry.ContentRoot, contentRoot) {
+		return false, nil
+	}
+
+	for k, step := range proof.Steps {
+		if k > 0 && !step.Entry.Mode.IsDir() {
+			return false, nil
+		}
+
+		parentRoot := root
+		if k < len(proof.Steps)-1 {
+			parentRoot = proof.Steps[k+1].Entry.ContentRoot
+		}
+
+		ok, err := merkletree.Verify(encodeEntry(step.Entry), parentRoot, step.Proof, config)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,187 @@
+package dirtree
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	merkletree "github.com/ahm23/go-merkletree-xxh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeTree lays out a small directory tree and returns its path.
+func makeTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"README":          "hello",
+		"src/main.go":     "package main",
+		"src/util/a.txt":  "aaaaaaaaaaaaaaaaaaaaaaaaa",
+		"src/util/b.txt":  "",
+		"docs/guide.md":   "# guide",
+		"docs/images/.gi": "keep",
+	}
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(root, "empty"), 0o755))
+	require.NoError(t, os.Symlink("README", filepath.Join(root, "link")))
+	return root
+}
+
+func TestHash(t *testing.T) {
+	t.Parallel()
+
+	opts := &Options{Config: &merkletree.Config{DomainSeperation: true}, ChunkSize: 8}
+
+	t.Run("is deterministic", func(t *testing.T) {
+		root := makeTree(t)
+		a, err := Hash(root, opts)
+		require.NoError(t, err)
+		b, err := Hash(root, opts)
+		require.NoError(t, err)
+		assert.Equal(t, a.Root, b.Root)
+
+		// The same layout elsewhere hashes the same.
+		c, err := Hash(makeTree(t), opts)
+		require.NoError(t, err)
+		assert.Equal(t, a.Root, c.Root)
+	})
+
+	t.Run("changes are localized", func(t *testing.T) {
+		root := makeTree(t)
+		before, err := Hash(root, opts)
+		require.NoError(t, err)
+
+		require.NoError(t, os.WriteFile(filepath.Join(root, "src", "util", "a.txt"), []byte("changed"), 0o644))
+		after, err := Hash(root, opts)
+		require.NoError(t, err)
+		assert.NotEqual(t, before.Root, after.Root)
+
+		for _, name := range []string{"src", "src/util", "src/util/a.txt"} {
+			b, err := before.Lookup(name)
+			require.NoError(t, err)
+			a, err := after.Lookup(name)
+			require.NoError(t, err)
+			assert.NotEqual(t, b.ContentRoot, a.ContentRoot, "%s should change", name)
+		}
+		for _, name := range []string{"docs", "README", "src/main.go", "src/util/b.txt"} {
+			b, err := before.Lookup(name)
+			require.NoError(t, err)
+			a, err := after.Lookup(name)
+			require.NoError(t, err)
+			assert.Equal(t, b.ContentRoot, a.ContentRoot, "%s should not change", name)
+		}
+	})
+
+	t.Run("mode and chunk size are committed to", func(t *testing.T) {
+		root := makeTree(t)
+		before, err := Hash(root, opts)
+		require.NoError(t, err)
+
+		rechunked, err := Hash(root, &Options{Config: opts.Config, ChunkSize: 4})
+		require.NoError(t, err)
+		assert.NotEqual(t, before.Root, rechunked.Root)
+
+		require.NoError(t, os.Chmod(filepath.Join(root, "README"), 0o600))
+		after, err := Hash(root, opts)
+		require.NoError(t, err)
+		assert.NotEqual(t, before.Root, after.Root)
+	})
+
+	t.Run("records entries", func(t *testing.T) {
+		tree, err := Hash(makeTree(t), opts)
+		require.NoError(t, err)
+
+		e, err := tree.Lookup("src/util/a.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "a.txt", e.Name)
+		assert.Equal(t, int64(25), e.Size)
+		assert.True(t, e.Mode.IsRegular())
+
+		e, err = tree.Lookup("link")
+		require.NoError(t, err)
+		assert.NotZero(t, e.Mode&os.ModeSymlink)
+
+		e, err = tree.Lookup("empty")
+		require.NoError(t, err)
+		assert.True(t, e.Mode.IsDir())
+
+		_, err = tree.Lookup("src/missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = tree.Lookup("README/nested")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("content roots are chunk trees", func(t *testing.T) {
+		tree, err := Hash(makeTree(t), opts)
+		require.NoError(t, err)
+
+		for name, leaves := range map[string][][]byte{
+			"src/util/a.txt": {fileHeader(25), []byte("aaaaaaaa"), []byte("aaaaaaaa"), []byte("aaaaaaaa"), []byte("a")},
+			"src/util/b.txt": {fileHeader(0), nil},
+			"link":           {fileHeader(6), []byte("README")},
+		} {
+			want, err := merkletree.New(opts.Config, leaves)
+			require.NoError(t, err)
+			e, err := tree.Lookup(name)
+			require.NoError(t, err)
+			assert.Equal(t, []byte(want.Root), e.ContentRoot, name)
+		}
+	})
+
+	t.Run("rejects files that change size", func(t *testing.T) {
+		h := &hasher{config: opts.Config, buf: make([]byte, 8)}
+		for _, size := range []int64{24, 26} {
+			src := &fileSource{r: strings.NewReader(strings.Repeat("a", 25)), buf: h.buf, size: size}
+			_, err := merkletree.RootFrom(context.Background(), h.config, src)
+			assert.ErrorIs(t, err, ErrFileChanged, "size %d", size)
+		}
+	})
+}
+
+func TestProve(t *testing.T) {
+	t.Parallel()
+
+	config := &merkletree.Config{XXH128: true}
+	tree, err := Hash(makeTree(t), &Options{Config: config, ChunkSize: 8})
+	require.NoError(t, err)
+
+	for _, name := range []string{"README", "link", "empty", "src/util", "src/util/a.txt", "src/util/b.txt", "docs/images/.gi"} {
+		entry, err := tree.Lookup(name)
+		require.NoError(t, err)
+
+		proof, err := tree.Prove(name)
+		require.NoError(t, err)
+
+		ok, err := VerifyPath(tree.Root, name, entry.ContentRoot, proof, config)
+		require.NoError(t, err)
+		assert.True(t, ok, "proof for %s should verify", name)
+	}
+
+	proof, err := tree.Prove("src/util/a.txt")
+	require.NoError(t, err)
+	other, err := tree.Lookup("src/util/b.txt")
+	require.NoError(t, err)
+
+	ok, err := VerifyPath(tree.Root, "src/util/a.txt", other.ContentRoot, proof, config)
+	require.NoError(t, err)
+	assert.False(t, ok, "wrong content root should fail")
+
+	_, err = VerifyPath(tree.Root, "src/util/b.txt", other.ContentRoot, proof, config)
+	assert.ErrorIs(t, err, ErrProofMismatch, "proof for another path should be rejected")
+
+	entry, err := tree.Lookup("src/util/a.txt")
+	require.NoError(t, err)
+	ok, err = VerifyPath([]byte("not the root...."), "src/util/a.txt", entry.ContentRoot, proof, config)
+	require.NoError(t, err)
+	assert.False(t, ok, "wrong tree root should fail")
+
+	_, err = tree.Prove("nope")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
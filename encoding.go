@@ -0,0 +1,130 @@
+package merkletree
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Names of the hash algorithms used in encoded proofs.
+const (
+	AlgorithmXXH3_64  = "xxh3-64"
+	AlgorithmXXH3_128 = "xxh3-128"
+)
+
+// Root is a Merkle root hash. It prints and marshals as lowercase hex.
+type Root []byte
+
+// String returns the root in hex.
+func (r Root) String() string {
+	return hex.EncodeToString(r)
+}
+
+// MarshalText encodes the root as hex.
+func (r Root) MarshalText() ([]byte, error) {
+	out := make([]byte, hex.EncodedLen(len(r)))
+	hex.Encode(out, r)
+	return out, nil
+}
+
+// UnmarshalText decodes a hex-encoded root.
+func (r *Root) UnmarshalText(text []byte) error {
+	decoded := make([]byte, hex.DecodedLen(len(text)))
+	if _, err := hex.Decode(decoded, text); err != nil {
+		return fmt.Errorf("merkletree: decoding root: %w", err)
+	}
+	*r = decoded
+	return nil
+}
+
+// proofJSON is the JSON form of a Proof.
+type proofJSON struct {
+	Index            uint64   `json:"index"`
+	LeafCount        int64    `json:"leafCount"`
+	Algorithm        string   `json:"algorithm"`
+	DomainSeperation bool     `json:"domainSeparation"`
+	SealRoot         bool     `json:"sealRoot,omitempty"`
+	Arity            int      `json:"arity,omitempty"`
+	Siblings         []string `json:"siblings"`
+	Omitted          string   `json:"omitted,omitempty"`
+}
+
+// MarshalJSON encodes the proof with hex siblings and the parameters of the
+// tree it was generated from, so that it can be verified without side channels.
+func (p Proof) MarshalJSON() ([]byte, error) {
+	out := proofJSON{
+		Index:            p.Index,
+		LeafCount:        int64(p.LeafCount),
+		Algorithm:        AlgorithmXXH3_64,
+		DomainSeperation: p.DomainSeperation,
+		SealRoot:         p.SealRoot,
+		Arity:            p.Arity,
+		Siblings:         make([]string, len(p.Siblings)),
+		Omitted:          hex.EncodeToString(p.Omitted),
+	}
+	if p.XXH128 {
+		out.Algorithm = AlgorithmXXH3_128
+	}
+	for i, sib := range p.Siblings {
+		out.Siblings[i] = hex.EncodeToString(sib)
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes a proof written by MarshalJSON.
+func (p *Proof) UnmarshalJSON(data []byte) error {
+	var in proofJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	if in.Arity != 0 && (in.Arity < 2 || in.Arity > 255) {
+		return fmt.Errorf("%w: proof has arity %d", ErrInvalidArity, in.Arity)
+	}
+
+	if in.LeafCount < 0 || in.LeafCount > maxLeafCount {
+		return fmt.Errorf("%w: proof leaf count %d out of range", ErrInvalidNumOfLeaves, in.LeafCount)
+	}
+
+	var width int
+	switch in.Algorithm {
+	case AlgorithmXXH3_64:
+		width = 8
+	case AlgorithmXXH3_128:
+		width = 16
+	default:
+		return fmt.Errorf("%w: unknown proof algorithm %q", ErrUnsupportedConfig, in.Algorithm)
+	}
+
+	siblings := make([][]byte, len(in.Siblings))
+	for i, sib := range in.Siblings {
+		decoded, err := hex.DecodeString(sib)
+		if err != nil {
+			return fmt.Errorf("%w: decoding sibling %d: %w", ErrSiblingLength, i, err)
+		}
+		if len(decoded) != width {
+			return &SiblingLengthError{Level: i, Got: len(decoded), Want: width}
+		}
+		siblings[i] = decoded
+	}
+
+	var omitted []byte
+	if in.Omitted != "" {
+		var err error
+		if omitted, err = hex.DecodeString(in.Omitted); err != nil {
+			return fmt.Errorf("%w: decoding: %w", ErrInvalidOmitted, err)
+		}
+	}
+
+	*p = Proof{
+		Siblings:         siblings,
+		Index:            in.Index,
+		LeafCount:        int(in.LeafCount),
+		XXH128:           width == 16,
+		DomainSeperation: in.DomainSeperation,
+		SealRoot:         in.SealRoot,
+		Arity:            in.Arity,
+		Omitted:          omitted,
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package merkletree
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProofJSON(t *testing.T) {
+	t.Parallel()
+
+	t.Run("round-trips and still verifies", func(t *testing.T) {
+		for _, cfg := range []*Config{
+			nil,
+			{DomainSeperation: true},
+			{XXH128: true, DomainSeperation: true, SealRoot: true},
+			{Arity: 4, DomainSeperation: true},
+		} {
+			input := generateRandomInputs(t, 7)
+			tree, err := New(cfg, input)
+			require.NoError(t, err)
+
+			proof, err := tree.Proof(6)
+			require.NoError(t, err)
+
+			data, err := json.Marshal(proof)
+			require.NoError(t, err)
+
+			var decoded Proof
+			require.NoError(t, json.Unmarshal(data, &decoded))
+			assert.Equal(t, *proof, decoded)
+
+			ok, err := Verify(input[6], tree.Root, &decoded, tree.Config)
+			require.NoError(t, err)
+			assert.True(t, ok)
+		}
+	})
+
+	t.Run("is self-describing", func(t *testing.T) {
+		proof := Proof{
+			Siblings:         [][]byte{{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}},
+			Index:            1,
+			LeafCount:        2,
+			XXH128:           true,
+			DomainSeperation: true,
+		}
+		data, err := json.Marshal(proof)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{
+			"index": 1,
+			"leafCount": 2,
+			"algorithm": "xxh3-128",
+			"domainSeparation": true,
+			"siblings": ["0102030405060708090a0b0c0d0e0f10"]
+		}`, string(data))
+	})
+
+	t.Run("rejects malformed proofs", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			data string
+			err  error
+		}{
+			"unknown algorithm": {`{"algorithm":"sha256","siblings":[]}`, ErrUnsupportedConfig},
+			"bad arity":         {`{"algorithm":"xxh3-64","arity":1,"siblings":[]}`, ErrInvalidArity},
+			"bad hex":           {`{"algorithm":"xxh3-64","siblings":["zz"]}`, ErrSiblingLength},
+			"wrong width":       {`{"algorithm":"xxh3-64","siblings":["0102"]}`, ErrSiblingLength},
+			"bad omitted":       {`{"algorithm":"xxh3-64","siblings":[],"omitted":"z"}`, ErrInvalidOmitted},
+			"huge leaf count":   {`{"algorithm":"xxh3-64","leafCount":72057594037927937,"siblings":[]}`, ErrInvalidNumOfLeaves},
+			"negative count":    {`{"algorithm":"xxh3-64","leafCount":-1,"siblings":[]}`, ErrInvalidNumOfLeaves},
+		} {
+			var p Proof
+			assert.ErrorIs(t, json.Unmarshal([]byte(tc.data), &p), tc.err, name)
+		}
+	})
+}
+
+func TestRoot(t *testing.T) {
+	t.Parallel()
+
+	tree, err := New(nil, generateRandomInputs(t, 4))
+	require.NoError(t, err)
+
+	text, err := tree.Root.MarshalText()
+	require.NoError(t, err)
+	assert.Equal(t, tree.Root.String(), string(text))
+	assert.Len(t, text, 16)
+
+	var decoded Root
+	require.NoError(t, decoded.UnmarshalText(text))
+	assert.Equal(t, tree.Root, decoded)
+
+	data, err := json.Marshal(struct{ Root Root }{tree.Root})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"Root":"`+tree.Root.String()+`"}`, string(data))
+
+	assert.Error(t, decoded.UnmarshalText([]byte("not hex")))
+}
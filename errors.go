@@ -1,10 +1,86 @@
 package merkletree
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrInvalidNumOfLeaves = errors.New("the number of leaves must be greater than 0")
 	ErrProofInvalidLeaf   = errors.New("this leaf is not a member of the merkle tree")
+	ErrProofInvalidIndex  = errors.New("leaf index is out of range")
 	ErrInputIsNil         = errors.New("input is nil")
 	ErrProofIsNil         = errors.New("proof is nil")
+	ErrHashSize           = errors.New("hash function returned an unexpected number of bytes")
+	ErrInvalidTreeFile    = errors.New("not a valid merkle tree file")
+	ErrProofLeafCount     = errors.New("sealed root requires the proof's leaf count")
+	ErrConfigMismatch     = errors.New("proof was generated with a different config")
+	ErrSiblingLength      = errors.New("proof sibling does not match the hash width")
+	ErrDepthMismatch      = errors.New("proof depth does not match its leaf count")
+	ErrRootMismatch       = errors.New("recomputed root does not match")
+	ErrBatchLength        = errors.New("inputs and proofs must have the same length")
+	ErrUnsupportedConfig  = errors.New("config option is not supported by this structure")
+	ErrInvalidMMRSize     = errors.New("not a valid mountain range size")
+	ErrProofMismatch      = errors.New("proof does not match this structure")
+	ErrInvalidFrontier    = errors.New("not a valid encoded frontier")
+	ErrInvalidArity       = errors.New("arity must be between 2 and 255")
+	ErrInvalidOmitted     = errors.New("omitted siblings do not fit the proof")
 )
+
+// indexError wraps ErrProofInvalidIndex with the offending index.
+func indexError(index, count int) error {
+	return fmt.Errorf("%w: %d not in [0, %d)", ErrProofInvalidIndex, index, count)
+}
+
+// leafCountError wraps ErrInvalidNumOfLeaves with the offending count.
+func leafCountError(count int) error {
+	return fmt.Errorf("%w: got %d", ErrInvalidNumOfLeaves, count)
+}
+
+// treeFileError wraps ErrInvalidTreeFile with what was wrong with the file.
+func treeFileError(reason string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidTreeFile, reason)
+}
+
+// ConfigMismatchError reports a tree parameter on which a proof and the
+// verifier's Config disagree. It matches ErrConfigMismatch with errors.Is.
+type ConfigMismatchError struct {
+	Field  string
+	Proof  any
+	Config any
+}
+
+func (e *ConfigMismatchError) Error() string {
+	return fmt.Sprintf("proof was generated with %s=%v but config has %s=%v", e.Field, e.Proof, e.Field, e.Config)
+}
+
+func (e *ConfigMismatchError) Unwrap() error { return ErrConfigMismatch }
+
+// SiblingLengthError reports a proof sibling whose length is inconsistent with
+// the hash width. It matches ErrSiblingLength with errors.Is.
+type SiblingLengthError struct {
+	Level int
+	Got   int
+	Want  int
+}
+
+func (e *SiblingLengthError) Error() string {
+	return fmt.Sprintf("proof sibling at level %d has %d bytes, want %d", e.Level, e.Got, e.Want)
+}
+
+func (e *SiblingLengthError) Unwrap() error { return ErrSiblingLength }
+
+// DepthMismatchError reports a proof whose number of siblings differs from the
+// depth of a tree with its recorded leaf count. It matches ErrDepthMismatch
+// with errors.Is.
+type DepthMismatchError struct {
+	LeafCount int
+	Got       int
+	Want      int
+}
+
+func (e *DepthMismatchError) Error() string {
+	return fmt.Sprintf("proof has %d siblings, want %d for %d leaves", e.Got, e.Want, e.LeafCount)
+}
+
+func (e *DepthMismatchError) Unwrap() error { return ErrDepthMismatch }
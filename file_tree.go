@@ -0,0 +1,473 @@
+package merkletree
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// File-backed tree layout (all integers little endian):
+//
+//	magic      [4]byte  "MXXH"
+//	version    uint8
+//	flags      uint8    fileFlag* bits
+//	hashSize   uint8
+//	arity      uint8    0 for a binary tree
+//	leafCount  uint64
+//	depth      uint32
+//	reserved   uint32
+//	root       [hashSize]byte
+//	levels     depth × {offset uint64, count uint64}
+//	level data, level 0 first, each count × hashSize bytes
+const (
+	fileMagic            = "MXXH"
+	fileVersion    uint8 = 1
+	fileHeaderSize       = 24
+	fileLevelEntry       = 16
+
+	fileFlagXXH128           uint8 = 1 << 0
+	fileFlagDomainSeperation uint8 = 1 << 1
+	fileFlagSealRoot         uint8 = 1 << 2
+)
+
+// FileTree serves proofs from a tree file written by BuildFile. On platforms
+// that support it the file is memory-mapped, so levels are read straight from
+// the page cache rather than loaded into the heap.
+type FileTree struct {
+	// Hash algorithm and domain separation mode the file was built with.
+	XXH128           bool
+	DomainSeperation bool
+	SealRoot         bool
+	// Arity the file was built with, 0 for a binary tree.
+	Arity int
+
+	// Merkle root node hash.
+	Root Root
+	// Depth of the Merkle tree.
+	Depth int
+	// Number of leaves in the Merkle tree.
+	LeafCount int
+
+	data     []byte
+	levels   [][]byte
+	hashSize int
+	unmap    func() error
+}
+
+// LeafSource yields the inputs of a tree's leaves in order. Next returns
+// io.EOF once every input has been returned. The slice it returns only needs
+// to stay valid until the next call.
+type LeafSource interface {
+	Next() ([]byte, error)
+}
+
+// SliceSource returns a LeafSource over inputs held in memory.
+func SliceSource(input [][]byte) LeafSource {
+	return &sliceSource{input: input}
+}
+
+type sliceSource struct {
+	input [][]byte
+}
+
+func (s *sliceSource) Next() ([]byte, error) {
+	if len(s.input) == 0 {
+		return nil, io.EOF
+	}
+	next := s.input[0]
+	s.input = s.input[1:]
+	return next, nil
+}
+
+// ChunkSource returns a LeafSource yielding consecutive size-byte chunks of
+// r, the last of which may be shorter. One buffer is reused for every chunk.
+func ChunkSource(r io.Reader, size int) LeafSource {
+	return &chunkSource{r: r, buf: make([]byte, size)}
+}
+
+type chunkSource struct {
+	r   io.Reader
+	buf []byte
+}
+
+func (s *chunkSource) Next() ([]byte, error) {
+	n, err := io.ReadFull(s.r, s.buf)
+	switch {
+	case n > 0 && (err == nil || err == io.ErrUnexpectedEOF):
+		return s.buf[:n], nil
+	case err == io.ErrUnexpectedEOF:
+		return nil, io.EOF
+	}
+	return nil, err
+}
+
+// BuildFile builds a tree over input and writes it to path, like
+// BuildFileFrom with a SliceSource.
+func BuildFile(ctx context.Context, path string, config *Config, input [][]byte) (Root, error) {
+	return BuildFileFrom(ctx, path, config, SliceSource(input))
+}
+
+// BuildFileFrom builds a tree over the inputs read from src and writes it to
+// path. Leaf hashes are spilled to a scratch file until the leaf count, and
+// with it the file layout, is known. Every internal level is then hashed
+// from the level below as it is read back from the file, so memory use does
+// not grow with the tree. The tree is written to a temporary file in the same
+// directory that replaces path only once it is complete; on error or
+// cancellation path is left untouched. It returns the tree's root.
+func BuildFileFrom(ctx context.Context, path string, config *Config, src LeafSource) (root Root, err error) {
+	if config == nil {
+		config = new(Config)
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	m := &MerkleTree{
+		Config:   config,
+		hashFunc: newHashFunc(config),
+		native:   len(config.Secret) == 0,
+	}
+
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "." // not os.TempDir, which may be on another file system
+	}
+	spill, err := os.CreateTemp(dir, base+".leaves-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		spill.Close()
+		os.Remove(spill.Name())
+	}()
+	if m.LeafCount, err = m.spillLeaves(ctx, src, spill); err != nil {
+		return nil, err
+	}
+	if m.LeafCount <= 1 {
+		return nil, leafCountError(m.LeafCount)
+	}
+	m.Depth = treeDepth(m.LeafCount, m.arity())
+
+	f, err := os.CreateTemp(dir, base+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if root, err = m.writeLevels(ctx, f, spill); err != nil {
+		return nil, err
+	}
+	// CreateTemp makes the file private; give it the mode os.Create would.
+	if err = f.Chmod(0o666 &^ umask()); err != nil {
+		return nil, err
+	}
+	if err = f.Sync(); err != nil {
+		return nil, err
+	}
+	if err = f.Close(); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// spillLeaves hashes every input of src and writes the leaf hashes to w. It
+// returns the number of leaves.
+func (m *MerkleTree) spillLeaves(ctx context.Context, src LeafSource, w io.Writer) (int, error) {
+	var native *nativeLeafHasher
+	if m.native {
+		native = m.newNativeLeafHasher()
+	}
+
+	var (
+		bw    = bufio.NewWriter(w)
+		width = m.hashSize()
+		leaf  = make([]byte, 0, width)
+		count int
+	)
+	for ; ; count++ {
+		if count%ctxCheckInterval == 0 {
+			if err := checkContext(ctx); err != nil {
+				return 0, err
+			}
+		}
+		input, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if leaf, err = m.appendLeaf(leaf[:0], input, native); err != nil {
+			return 0, err
+		}
+		if len(leaf) != width {
+			return 0, fmt.Errorf("%w: leaf %d has %d bytes, want %d", ErrHashSize, count, len(leaf), width)
+		}
+		if _, err := bw.Write(leaf); err != nil {
+			return 0, err
+		}
+	}
+	m.reportProgress(StageLeaves, 0, count, count)
+	return count, bw.Flush()
+}
+
+// writeLevels writes the header, the leaves copied from spill and every
+// internal level to f, and returns the root. Each level is read back from f
+// to hash the next one.
+func (m *MerkleTree) writeLevels(ctx context.Context, f *os.File, spill *os.File) (Root, error) {
+	var (
+		width  = m.hashSize()
+		k      = m.arity()
+		native = m.native && k == 2
+		header = encodeFileHeader(m)
+		offset = int64(len(header))
+		w      = bufio.NewWriter(f)
+	)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	// below reads the level under the one being written; the leaves come
+	// from the spill file, later levels from f itself.
+	var below io.Reader = io.NewSectionReader(spill, 0, int64(m.LeafCount*width))
+	var (
+		node     = make([]byte, width)
+		children = make([]byte, 0, k*width)
+		parent   = make([]byte, 0, width)
+		raw      []byte
+		top      []byte
+		err      error
+	)
+	for level := 0; level < m.Depth; level++ {
+		count, padded := levelCount(m.LeafCount, level, k), paddedLevelCount(m.LeafCount, level, k)
+		r := bufio.NewReader(below)
+		for i := 0; i < padded; i++ {
+			if i%ctxCheckInterval == 0 {
+				if err := checkContext(ctx); err != nil {
+					return nil, err
+				}
+				if level > 0 {
+					m.reportProgress(StageGrow, level, i, padded)
+				}
+			}
+			// Padding repeats the last node, which is still in node.
+			if i < count {
+				if level == 0 {
+					_, err = io.ReadFull(r, node)
+				} else {
+					children = children[:0]
+					for c := 0; c < k && err == nil; c++ {
+						children = children[:len(children)+width]
+						_, err = io.ReadFull(r, children[len(children)-width:])
+					}
+					if err == nil {
+						parent, raw, err = m.appendParent(parent[:0], raw, children, native)
+						copy(node, parent)
+					}
+				}
+				if err != nil {
+					return nil, fmt.Errorf("merkletree: reading level %d: %w", level, err)
+				}
+			}
+			if _, err := w.Write(node); err != nil {
+				return nil, err
+			}
+			if level == m.Depth-1 {
+				top = append(top, node...)
+			}
+		}
+		if level > 0 {
+			m.reportProgress(StageGrow, level, padded, padded)
+		}
+
+		if err := w.Flush(); err != nil {
+			return nil, err
+		}
+		below = io.NewSectionReader(f, offset, int64(padded*width))
+		offset += int64(padded * width)
+	}
+
+	root, err := m.hashRoot(top)
+	if err != nil {
+		return nil, err
+	}
+	m.reportProgress(StageGrow, m.Depth, 1, 1)
+	if _, err := f.WriteAt(root, fileHeaderSize); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// encodeFileHeader encodes the header, a zeroed root and the level table for m.
+func encodeFileHeader(m *MerkleTree) []byte {
+	width := m.hashSize()
+	buf := make([]byte, fileHeaderSize+width+m.Depth*fileLevelEntry)
+
+	copy(buf, fileMagic)
+	buf[4] = fileVersion
+	if m.XXH128 {
+		buf[5] |= fileFlagXXH128
+	}
+	if m.DomainSeperation {
+		buf[5] |= fileFlagDomainSeperation
+	}
+	if m.SealRoot {
+		buf[5] |= fileFlagSealRoot
+	}
+	buf[6] = uint8(width)
+	buf[7] = uint8(m.Arity)
+	binary.LittleEndian.PutUint64(buf[8:], uint64(m.LeafCount))
+	binary.LittleEndian.PutUint32(buf[16:], uint32(m.Depth))
+
+	offset := uint64(len(buf))
+	table := buf[fileHeaderSize+width:]
+	for level := 0; level < m.Depth; level++ {
+		count := uint64(paddedLevelCount(m.LeafCount, level, m.arity()))
+		binary.LittleEndian.PutUint64(table[level*fileLevelEntry:], offset)
+		binary.LittleEndian.PutUint64(table[level*fileLevelEntry+8:], count)
+		offset += count * uint64(width)
+	}
+	return buf
+}
+
+// OpenFile opens a tree file written by BuildFile.
+func OpenFile(path string) (*FileTree, error) {
+	data, unmap, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := parseTreeFile(data)
+	if err != nil {
+		_ = unmap()
+		return nil, err
+	}
+	t.unmap = unmap
+	return t, nil
+}
+
+// parseTreeFile validates the header and level table and slices out the levels.
+func parseTreeFile(data []byte) (*FileTree, error) {
+	if len(data) < fileHeaderSize || !bytes.Equal(data[:4], []byte(fileMagic)) {
+		return nil, treeFileError("missing header")
+	}
+	if data[4] != fileVersion {
+		return nil, treeFileError(fmt.Sprintf("unsupported version %d", data[4]))
+	}
+
+	flags, width := data[5], int(data[6])
+	t := &FileTree{
+		XXH128:           flags&fileFlagXXH128 != 0,
+		DomainSeperation: flags&fileFlagDomainSeperation != 0,
+		SealRoot:         flags&fileFlagSealRoot != 0,
+		Arity:            int(data[7]),
+		LeafCount:        int(binary.LittleEndian.Uint64(data[8:])),
+		Depth:            int(binary.LittleEndian.Uint32(data[16:])),
+		data:             data,
+		hashSize:         width,
+	}
+
+	wantWidth := 8
+	if t.XXH128 {
+		wantWidth = 16
+	}
+	if width != wantWidth {
+		return nil, treeFileError(fmt.Sprintf("hash size %d, want %d", width, wantWidth))
+	}
+	if t.Arity == 1 {
+		return nil, treeFileError("arity 1")
+	}
+	if t.LeafCount <= 1 || t.LeafCount > maxLeafCount {
+		return nil, treeFileError(fmt.Sprintf("leaf count %d out of range", t.LeafCount))
+	}
+	if t.Depth != treeDepth(t.LeafCount, t.config().arity()) {
+		return nil, treeFileError(fmt.Sprintf("depth %d does not fit %d leaves", t.Depth, t.LeafCount))
+	}
+
+	tableStart := fileHeaderSize + width
+	offset := uint64(tableStart + t.Depth*fileLevelEntry)
+	if uint64(len(data)) < offset {
+		return nil, treeFileError("truncated level table")
+	}
+	t.Root = bytes.Clone(data[fileHeaderSize:tableStart])
+
+	t.levels = make([][]byte, t.Depth)
+	for level := 0; level < t.Depth; level++ {
+		entry := data[tableStart+level*fileLevelEntry:]
+		start := binary.LittleEndian.Uint64(entry)
+		count := binary.LittleEndian.Uint64(entry[8:])
+		if start != offset || count != uint64(paddedLevelCount(t.LeafCount, level, t.config().arity())) {
+			return nil, treeFileError(fmt.Sprintf("bad table entry for level %d", level))
+		}
+		end := start + count*uint64(width)
+		if end > uint64(len(data)) {
+			return nil, treeFileError(fmt.Sprintf("level %d is truncated", level))
+		}
+		t.levels[level] = data[start:end:end]
+		offset = end
+	}
+	if offset != uint64(len(data)) {
+		return nil, treeFileError("trailing data")
+	}
+	return t, nil
+}
+
+// Proof generates the Merkle proof for the leaf at index. Siblings are copied
+// out of the file, so the proof stays valid after Close.
+func (t *FileTree) Proof(index int) (*Proof, error) {
+	if t.levels == nil {
+		return nil, os.ErrClosed
+	}
+	if index < 0 || index >= t.LeafCount {
+		return nil, indexError(index, t.LeafCount)
+	}
+	return buildProof(index, t.LeafCount, t.Depth, t.config(), t.nodeAt)
+}
+
+// config returns the tree settings recorded in the file.
+func (t *FileTree) config() *Config {
+	return &Config{XXH128: t.XXH128, DomainSeperation: t.DomainSeperation, SealRoot: t.SealRoot, Arity: t.Arity}
+}
+
+// Leaf returns a copy of the leaf hash at index.
+func (t *FileTree) Leaf(index int) ([]byte, error) {
+	if t.levels == nil {
+		return nil, os.ErrClosed
+	}
+	if index < 0 || index >= t.LeafCount {
+		return nil, indexError(index, t.LeafCount)
+	}
+	leaf, err := t.nodeAt(0, index)
+	return bytes.Clone(leaf), err
+}
+
+func (t *FileTree) nodeAt(level, index int) ([]byte, error) {
+	nodes := t.levels[level]
+	if count := len(nodes) / t.hashSize; index >= count {
+		index = count - 1
+	}
+	return nodes[index*t.hashSize : (index+1)*t.hashSize], nil
+}
+
+// Close releases the file mapping. The tree must not be used afterwards.
+func (t *FileTree) Close() error {
+	if t.unmap == nil {
+		return nil
+	}
+	err := t.unmap()
+	t.unmap, t.levels, t.data = nil, nil, nil
+	return err
+}
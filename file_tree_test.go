@@ -0,0 +1,263 @@
+package merkletree
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileTree(t *testing.T) {
+	t.Parallel()
+
+	t.Run("serves the same proofs as the in-memory tree", func(t *testing.T) {
+		configs := []*Config{
+			nil,
+			{DomainSeperation: true},
+			{XXH128: true, DomainSeperation: true, SealRoot: true},
+			{Seed: 5, Secret: []byte("key")},
+			{Arity: 3},
+			{Arity: 16, DomainSeperation: true, SealRoot: true},
+		}
+
+		for _, n := range []int{2, 3, 7, 16, 21} {
+			input := generateRandomInputs(t, n)
+			for _, cfg := range configs {
+				tree, err := New(cfg, input)
+				require.NoError(t, err)
+
+				path := filepath.Join(t.TempDir(), "tree.mxxh")
+				root, err := BuildFile(context.Background(), path, cfg, input)
+				require.NoError(t, err)
+				assert.Equal(t, tree.Root, root)
+
+				ft, err := OpenFile(path)
+				require.NoError(t, err)
+				assert.Equal(t, tree.Root, ft.Root)
+				assert.Equal(t, tree.LeafCount, ft.LeafCount)
+				assert.Equal(t, tree.Depth, ft.Depth)
+
+				for i := range input {
+					want, err := tree.Proof(i)
+					require.NoError(t, err)
+					got, err := ft.Proof(i)
+					require.NoError(t, err)
+					assert.Equal(t, want, got, "proof mismatch for leaf %d of %d", i, n)
+
+					leaf, err := ft.Leaf(i)
+					require.NoError(t, err)
+					assert.Equal(t, tree.Leaves[i], leaf)
+				}
+
+				require.NoError(t, ft.Close())
+			}
+		}
+	})
+
+	t.Run("proofs outlive the mapping", func(t *testing.T) {
+		input := generateRandomInputs(t, 9)
+		path := filepath.Join(t.TempDir(), "tree.mxxh")
+		root, err := BuildFile(context.Background(), path, nil, input)
+		require.NoError(t, err)
+
+		ft, err := OpenFile(path)
+		require.NoError(t, err)
+		proof, err := ft.Proof(8)
+		require.NoError(t, err)
+		require.NoError(t, ft.Close())
+
+		ok, err := Verify(input[8], root, proof, nil)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		_, err = ft.Proof(0)
+		assert.ErrorIs(t, err, os.ErrClosed)
+	})
+
+	t.Run("rejects out of range index", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "tree.mxxh")
+		_, err := BuildFile(context.Background(), path, nil, generateRandomInputs(t, 4))
+		require.NoError(t, err)
+
+		ft, err := OpenFile(path)
+		require.NoError(t, err)
+		defer ft.Close()
+
+		_, err = ft.Proof(4)
+		assert.ErrorIs(t, err, ErrProofInvalidIndex)
+	})
+
+	t.Run("rejects corrupt files", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "tree.mxxh")
+		_, err := BuildFile(context.Background(), path, nil, generateRandomInputs(t, 5))
+		require.NoError(t, err)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		badMagic := append([]byte("XXXX"), data[4:]...)
+		truncated := data[:len(data)-1]
+		trailing := append(append([]byte(nil), data...), 0)
+		badCount := append([]byte(nil), data...)
+		badCount[8] = 2
+		hugeCount := append([]byte(nil), data...)
+		binary.LittleEndian.PutUint64(hugeCount[8:], 1<<62+1)
+
+		for name, corrupt := range map[string][]byte{
+			"bad magic":        badMagic,
+			"truncated":        truncated,
+			"trailing data":    trailing,
+			"bad leaf count":   badCount,
+			"huge leaf count":  hugeCount,
+			"header too short": data[:10],
+		} {
+			p := filepath.Join(t.TempDir(), "corrupt.mxxh")
+			require.NoError(t, os.WriteFile(p, corrupt, 0o600))
+
+			ft, err := OpenFile(p)
+			assert.ErrorIs(t, err, ErrInvalidTreeFile, name)
+			assert.Nil(t, ft, name)
+		}
+	})
+
+	t.Run("rejects invalid leaf counts", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "tree.mxxh")
+		_, err := BuildFile(context.Background(), path, nil, generateRandomInputs(t, 1))
+		assert.ErrorIs(t, err, ErrInvalidNumOfLeaves)
+
+		_, err = BuildFileFrom(context.Background(), path, nil, ChunkSource(bytes.NewReader(nil), 4))
+		assert.ErrorIs(t, err, ErrInvalidNumOfLeaves)
+	})
+
+	t.Run("streams chunks of a reader", func(t *testing.T) {
+		data := make([]byte, 10000)
+		_, err := rand.Read(data)
+		require.NoError(t, err)
+
+		var chunks [][]byte
+		for rest := data; len(rest) > 0; rest = rest[min(len(rest), 64):] {
+			chunks = append(chunks, rest[:min(len(rest), 64)])
+		}
+		cfg := &Config{DomainSeperation: true}
+		tree, err := New(cfg, chunks)
+		require.NoError(t, err)
+
+		path := filepath.Join(t.TempDir(), "tree.mxxh")
+		root, err := BuildFileFrom(context.Background(), path, cfg, ChunkSource(bytes.NewReader(data), 64))
+		require.NoError(t, err)
+		assert.Equal(t, tree.Root, root)
+
+		ft, err := OpenFile(path)
+		require.NoError(t, err)
+		defer ft.Close()
+		assert.Equal(t, len(chunks), ft.LeafCount)
+		for _, i := range []int{0, 77, len(chunks) - 1} {
+			want, err := tree.Proof(i)
+			require.NoError(t, err)
+			got, err := ft.Proof(i)
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		}
+	})
+
+	t.Run("leaves the existing file untouched on failure", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "tree.mxxh")
+		input := generateRandomInputs(t, 40)
+		_, err := BuildFile(context.Background(), path, nil, input)
+		require.NoError(t, err)
+		before, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		failing := &failingSource{LeafSource: SliceSource(input), after: 20}
+		_, err = BuildFileFrom(context.Background(), path, nil, failing)
+		assert.ErrorIs(t, err, errSourceFailed)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = BuildFile(ctx, path, nil, input)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		after, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, before, after)
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1, "temporary files must be removed")
+		assert.Equal(t, "tree.mxxh", entries[0].Name())
+	})
+
+	t.Run("creates the file with the default mode", func(t *testing.T) {
+		dir := t.TempDir()
+		plain, err := os.Create(filepath.Join(dir, "plain"))
+		require.NoError(t, err)
+		require.NoError(t, plain.Close())
+		want, err := os.Stat(plain.Name())
+		require.NoError(t, err)
+
+		path := filepath.Join(dir, "tree.mxxh")
+		_, err = BuildFile(context.Background(), path, nil, generateRandomInputs(t, 4))
+		require.NoError(t, err)
+		got, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, want.Mode(), got.Mode())
+	})
+}
+
+// Not parallel: it changes the working directory and TMPDIR.
+func TestBuildFile_RelativePath(t *testing.T) {
+	tmp, work := t.TempDir(), t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(work))
+	defer func() { require.NoError(t, os.Chdir(wd)) }()
+
+	src := &listingSource{LeafSource: SliceSource(generateRandomInputs(t, 4)), dir: work}
+	_, err = BuildFileFrom(context.Background(), "tree.mxxh", nil, src)
+	require.NoError(t, err)
+	assert.Len(t, src.entries, 1, "the scratch file belongs next to the target")
+
+	tree, err := OpenFile("tree.mxxh")
+	require.NoError(t, err)
+	require.NoError(t, tree.Close())
+}
+
+var errSourceFailed = errors.New("source failed")
+
+// failingSource fails after returning a number of inputs.
+type failingSource struct {
+	LeafSource
+	after int
+}
+
+func (s *failingSource) Next() ([]byte, error) {
+	if s.after == 0 {
+		return nil, errSourceFailed
+	}
+	s.after--
+	return s.LeafSource.Next()
+}
+
+// listingSource lists dir once its inputs are exhausted.
+type listingSource struct {
+	LeafSource
+	dir     string
+	entries []os.DirEntry
+}
+
+func (s *listingSource) Next() ([]byte, error) {
+	data, err := s.LeafSource.Next()
+	if err == io.EOF {
+		s.entries, _ = os.ReadDir(s.dir)
+	}
+	return data, err
+}
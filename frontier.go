@@ -0,0 +1,237 @@
+package merkletree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// Encoded frontier layout (integers little endian):
+//
+//	version    uint8
+//	flags      uint8    fileFlag* bits
+//	count      uint64   number of leaves pushed
+//	hashes     one hashSize-wide subtree root per set bit of count, lowest first;
+//	           with SealRoot and a power-of-two count, the two children of
+//	           the single subtree instead
+const (
+	frontierVersion    uint8 = 1
+	frontierHeaderSize       = 10
+)
+
+// Frontier is an append-only accumulator that keeps only the roots of the
+// perfect subtrees along the right edge of the tree, one per set bit of the
+// leaf count. Its root is identical to that of New over the same inputs, so a
+// device can follow an ever-growing log in O(log n) memory. Only binary trees
+// are supported. A Frontier is not safe for concurrent use.
+type Frontier struct {
+	*Config
+	hashFunc appendHashFunc
+	count    uint64
+	// subtrees[k] is the root of the perfect subtree of 2^k leaves present
+	// when bit k of count is set, and nil otherwise.
+	subtrees [][]byte
+	// top holds the concatenated children of the single subtree when SealRoot
+	// is set and count is a power of two, as the sealed root rehashes them.
+	top []byte
+	raw []byte
+}
+
+// NewFrontier returns an empty frontier.
+func NewFrontier(config *Config) (*Frontier, error) {
+	if config == nil {
+		config = new(Config)
+	}
+	if config.arity() != 2 {
+		return nil, fmt.Errorf("%w: Arity %d", ErrUnsupportedConfig, config.Arity)
+	}
+	return &Frontier{Config: config, hashFunc: newHashFunc(config)}, nil
+}
+
+// LeafCount returns the number of leaves pushed.
+func (f *Frontier) LeafCount() uint64 {
+	return f.count
+}
+
+// Push appends the leaf for data, merging the subtrees it completes.
+func (f *Frontier) Push(data []byte) error {
+	node, err := sproutLeaf(nil, data, f.hashFunc, f.DomainSeperation)
+	if err != nil {
+		return err
+	}
+
+	k := 0
+	for ; f.count&(1<<k) != 0; k++ {
+		if f.SealRoot && f.count+1 == 1<<(k+1) {
+			// this merge builds the top of a power-of-two tree
+			f.top = append(append(f.top[:0], f.subtrees[k]...), node...)
+		}
+		if node, err = f.hashNode(f.subtrees[k], node); err != nil {
+			return err
+		}
+		f.subtrees[k] = nil
+	}
+	for len(f.subtrees) <= k {
+		f.subtrees = append(f.subtrees, nil)
+	}
+	f.subtrees[k] = node
+	f.count++
+	return nil
+}
+
+// Root returns the root of a tree over the leaves pushed so far, which must
+// number at least two.
+func (f *Frontier) Root() (Root, error) {
+	if f.count <= 1 {
+		return nil, fmt.Errorf("%w: got %d", ErrInvalidNumOfLeaves, f.count)
+	}
+
+	depth := bits.Len64(f.count - 1)
+	low := bits.TrailingZeros64(f.count)
+	if low == depth {
+		if f.SealRoot {
+			return f.hashRoot(f.top[:f.hashSize()], f.top[f.hashSize():])
+		}
+		return bytes.Clone(f.subtrees[low]), nil
+	}
+	root := bytes.Clone(f.subtrees[low])
+
+	// Walk up the right edge. The rightmost node of level k has an index
+	// whose parity tells whether it pairs with the subtree to its left or,
+	// as the odd node out, with its own duplicate.
+	var err error
+	for k := low; k < depth; k++ {
+		index := f.count>>k - 1
+		if k > low {
+			index = f.count >> k
+		}
+		left, right := root, root
+		if index&1 == 1 {
+			left = f.subtrees[k]
+		}
+		if k == depth-1 {
+			root, err = f.hashRoot(left, right)
+		} else {
+			root, err = f.hashNode(left, right)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return root, nil
+}
+
+func (f *Frontier) hashNode(left, right []byte) ([]byte, error) {
+	f.raw = appendNodeInput(f.raw[:0], left, right, f.DomainSeperation)
+	return f.hashFunc(nil, f.raw)
+}
+
+// hashRoot hashes the two top-level nodes into the root, sealing it with the
+// tree's metadata when SealRoot is set.
+func (f *Frontier) hashRoot(left, right []byte) ([]byte, error) {
+	f.raw = appendNodeInput(f.raw[:0], left, right, f.DomainSeperation)
+	if f.SealRoot {
+		f.raw = append(f.raw, treeMetadata(int(f.count), f.Config)...)
+	}
+	return f.hashFunc(nil, f.raw)
+}
+
+// sealedTop reports whether the encoding holds the children of the single
+// subtree rather than its root.
+func sealedTop(sealRoot bool, count uint64) bool {
+	return sealRoot && count >= 2 && count&(count-1) == 0
+}
+
+func (f *Frontier) hashSize() int {
+	if f.XXH128 {
+		return 16
+	}
+	return 8
+}
+
+// MarshalBinary encodes the leaf count and subtree roots. The seed and secret
+// are not encoded.
+func (f *Frontier) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, frontierHeaderSize, frontierHeaderSize+bits.OnesCount64(f.count)*f.hashSize())
+	buf[0] = frontierVersion
+	if f.XXH128 {
+		buf[1] |= fileFlagXXH128
+	}
+	if f.DomainSeperation {
+		buf[1] |= fileFlagDomainSeperation
+	}
+	if f.SealRoot {
+		buf[1] |= fileFlagSealRoot
+	}
+	binary.LittleEndian.PutUint64(buf[2:], f.count)
+	if sealedTop(f.SealRoot, f.count) {
+		return append(buf, f.top...), nil
+	}
+	for _, node := range f.subtrees {
+		buf = append(buf, node...)
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary restores a frontier encoded by MarshalBinary. If f has a
+// Config, its hash algorithm, domain separation and sealing modes must match
+// the encoded ones; otherwise a Config is derived from the encoding.
+func (f *Frontier) UnmarshalBinary(data []byte) error {
+	if len(data) < frontierHeaderSize || data[0] != frontierVersion {
+		return fmt.Errorf("%w: missing header", ErrInvalidFrontier)
+	}
+	flags := data[1]
+	if flags&^(fileFlagXXH128|fileFlagDomainSeperation|fileFlagSealRoot) != 0 {
+		return fmt.Errorf("%w: unknown flags %#x", ErrInvalidFrontier, flags)
+	}
+	xxh128 := flags&fileFlagXXH128 != 0
+	domainSep := flags&fileFlagDomainSeperation != 0
+	sealRoot := flags&fileFlagSealRoot != 0
+
+	config := f.Config
+	if config == nil {
+		config = &Config{XXH128: xxh128, DomainSeperation: domainSep, SealRoot: sealRoot}
+	} else if config.XXH128 != xxh128 {
+		return &ConfigMismatchError{Field: "XXH128", Proof: xxh128, Config: config.XXH128}
+	} else if config.DomainSeperation != domainSep {
+		return &ConfigMismatchError{Field: "DomainSeperation", Proof: domainSep, Config: config.DomainSeperation}
+	} else if config.SealRoot != sealRoot {
+		return &ConfigMismatchError{Field: "SealRoot", Proof: sealRoot, Config: config.SealRoot}
+	}
+
+	width := 8
+	if xxh128 {
+		width = 16
+	}
+	count := binary.LittleEndian.Uint64(data[2:])
+	hashes := data[frontierHeaderSize:]
+	want := bits.OnesCount64(count) * width
+	if sealedTop(sealRoot, count) {
+		want = 2 * width
+	}
+	if len(hashes) != want {
+		return fmt.Errorf("%w: %d bytes of subtree roots for %d leaves", ErrInvalidFrontier, len(hashes), count)
+	}
+
+	g := Frontier{Config: config, hashFunc: newHashFunc(config), count: count}
+	g.subtrees = make([][]byte, bits.Len64(count))
+	if sealedTop(sealRoot, count) {
+		g.top = bytes.Clone(hashes)
+		top, err := g.hashNode(g.top[:width], g.top[width:])
+		if err != nil {
+			return err
+		}
+		g.subtrees[len(g.subtrees)-1] = top
+	} else {
+		for k := range g.subtrees {
+			if count&(1<<k) != 0 {
+				g.subtrees[k] = bytes.Clone(hashes[:width])
+				hashes = hashes[width:]
+			}
+		}
+	}
+
+	*f = g
+	return nil
+}
@@ -0,0 +1,140 @@
+package merkletree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrontier(t *testing.T) {
+	t.Parallel()
+
+	t.Run("matches New for every size", func(t *testing.T) {
+		for _, cfg := range []*Config{
+			{},
+			{DomainSeperation: true},
+			{XXH128: true, DomainSeperation: true},
+			{Seed: 11, Secret: []byte("key")},
+			{SealRoot: true},
+			{XXH128: true, DomainSeperation: true, SealRoot: true},
+		} {
+			f, err := NewFrontier(cfg)
+			require.NoError(t, err)
+
+			input := generateRandomInputs(t, 70)
+			for i, data := range input {
+				require.NoError(t, f.Push(data))
+				if i == 0 {
+					continue
+				}
+
+				tree, err := New(cfg, input[:i+1])
+				require.NoError(t, err)
+				root, err := f.Root()
+				require.NoError(t, err)
+				assert.Equal(t, tree.Root, root, "%d leaves", i+1)
+			}
+			assert.Equal(t, uint64(70), f.LeafCount())
+			assert.LessOrEqual(t, len(f.subtrees), 7)
+		}
+	})
+
+	t.Run("round-trips through its encoding", func(t *testing.T) {
+		cfg := &Config{XXH128: true, DomainSeperation: true}
+		f, err := NewFrontier(cfg)
+		require.NoError(t, err)
+		input := generateRandomInputs(t, 23)
+		for _, data := range input[:13] {
+			require.NoError(t, f.Push(data))
+		}
+
+		data, err := f.MarshalBinary()
+		require.NoError(t, err)
+		assert.Len(t, data, frontierHeaderSize+3*16)
+
+		var restored Frontier
+		require.NoError(t, restored.UnmarshalBinary(data))
+		for _, data := range input[13:] {
+			require.NoError(t, f.Push(data))
+			require.NoError(t, restored.Push(data))
+		}
+
+		want, err := f.Root()
+		require.NoError(t, err)
+		got, err := restored.Root()
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+
+		mismatched, err := NewFrontier(&Config{DomainSeperation: true})
+		require.NoError(t, err)
+		assert.ErrorIs(t, mismatched.UnmarshalBinary(data), ErrConfigMismatch)
+	})
+
+	t.Run("round-trips sealed at every size", func(t *testing.T) {
+		cfg := &Config{DomainSeperation: true, SealRoot: true}
+		f, err := NewFrontier(cfg)
+		require.NoError(t, err)
+
+		input := generateRandomInputs(t, 20)
+		for i, data := range input {
+			require.NoError(t, f.Push(data))
+			if i == 0 {
+				continue
+			}
+
+			encoded, err := f.MarshalBinary()
+			require.NoError(t, err)
+			var restored Frontier
+			require.NoError(t, restored.UnmarshalBinary(encoded))
+			assert.True(t, restored.SealRoot)
+
+			want, err := f.Root()
+			require.NoError(t, err)
+			got, err := restored.Root()
+			require.NoError(t, err)
+			assert.Equal(t, want, got, "%d leaves", i+1)
+
+			// The restored frontier keeps growing into the same roots.
+			require.NoError(t, restored.Push([]byte("next")))
+			g := *f
+			g.subtrees = append([][]byte(nil), f.subtrees...)
+			g.top = append([]byte(nil), f.top...)
+			require.NoError(t, g.Push([]byte("next")))
+			want, err = g.Root()
+			require.NoError(t, err)
+			got, err = restored.Root()
+			require.NoError(t, err)
+			assert.Equal(t, want, got, "%d leaves, then one more", i+1)
+		}
+
+		unsealed, err := NewFrontier(&Config{DomainSeperation: true})
+		require.NoError(t, err)
+		encoded, err := f.MarshalBinary()
+		require.NoError(t, err)
+		assert.ErrorIs(t, unsealed.UnmarshalBinary(encoded), ErrConfigMismatch)
+	})
+
+	t.Run("rejects invalid input", func(t *testing.T) {
+		_, err := NewFrontier(&Config{Arity: 4})
+		assert.ErrorIs(t, err, ErrUnsupportedConfig)
+
+		f, err := NewFrontier(nil)
+		require.NoError(t, err)
+		require.NoError(t, f.Push([]byte("only")))
+		_, err = f.Root()
+		assert.ErrorIs(t, err, ErrInvalidNumOfLeaves)
+
+		data, err := f.MarshalBinary()
+		require.NoError(t, err)
+		for name, corrupt := range map[string][]byte{
+			"short":       data[:5],
+			"bad version": append([]byte{9}, data[1:]...),
+			"bad flags":   append([]byte{data[0], 0x80}, data[2:]...),
+			"truncated":   data[:len(data)-1],
+		} {
+			var g Frontier
+			assert.ErrorIs(t, g.UnmarshalBinary(corrupt), ErrInvalidFrontier, name)
+		}
+	})
+}
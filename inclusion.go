@@ -0,0 +1,143 @@
+package merkletree
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Inclusion answers a position query over the tree: it binds a leaf hash to
+// its index and to the size of the tree, together with the proof that ties
+// them to the root. It can only be produced and verified for trees built with
+// SealRoot.
+type Inclusion struct {
+	// Leaf hash at Index.
+	Leaf []byte
+	// Index of the leaf in the tree.
+	Index int
+	// Number of leaves in the tree.
+	LeafCount int
+	Proof     *Proof
+}
+
+// Leaf returns a copy of the leaf hash at index.
+func (m *MerkleTree) Leaf(index int) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if index < 0 || index >= m.LeafCount {
+		return nil, indexError(index, m.LeafCount)
+	}
+	return bytes.Clone(m.Leaves[index]), nil
+}
+
+// IndexOf returns the index of the leaf hashed from input. If several leaves
+// hold the same input, the index of any one of them is returned.
+func (m *MerkleTree) IndexOf(input []byte) (int, error) {
+	leaf, err := sproutLeaf(nil, input, m.hashFunc, m.DomainSeperation)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	index, ok := m.leafMap[string(leaf)]
+	if !ok {
+		return 0, ErrProofInvalidLeaf
+	}
+	return index, nil
+}
+
+// Inclusion returns the leaf at index with its proof. It fails with
+// ErrUnsupportedConfig for a tree built without SealRoot.
+func (m *MerkleTree) Inclusion(index int) (*Inclusion, error) {
+	if err := m.checkSealed(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.inclusion(index)
+}
+
+// InclusionOf returns the leaf hashed from input with its index and proof. It
+// fails with ErrUnsupportedConfig for a tree built without SealRoot.
+func (m *MerkleTree) InclusionOf(input []byte) (*Inclusion, error) {
+	if err := m.checkSealed(); err != nil {
+		return nil, err
+	}
+
+	leaf, err := sproutLeaf(nil, input, m.hashFunc, m.DomainSeperation)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	index, ok := m.leafMap[string(leaf)]
+	if !ok {
+		return nil, ErrProofInvalidLeaf
+	}
+	return m.inclusion(index)
+}
+
+// checkSealed rejects trees whose root does not commit to the leaf count,
+// as VerifyInclusion does.
+func (m *MerkleTree) checkSealed() error {
+	if !m.SealRoot {
+		return fmt.Errorf("%w: an inclusion requires SealRoot", ErrUnsupportedConfig)
+	}
+	return nil
+}
+
+func (m *MerkleTree) inclusion(index int) (*Inclusion, error) {
+	proof, err := m.proof(index)
+	if err != nil {
+		return nil, err
+	}
+	return &Inclusion{
+		Leaf:      bytes.Clone(m.Leaves[index]),
+		Index:     index,
+		LeafCount: m.LeafCount,
+		Proof:     proof,
+	}, nil
+}
+
+// VerifyInclusion checks that input hashes to inc.Leaf, that the proof is for
+// inc.Index of a tree with inc.LeafCount leaves, and that it verifies against
+// root. Only a sealed root commits to the leaf count: without it the padding
+// copies of the last leaf could be proven at indices past the end of the
+// tree. VerifyInclusion therefore requires SealRoot and fails with
+// ErrUnsupportedConfig otherwise. If config is nil, the modes recorded in the
+// proof are used, as with Verify.
+func VerifyInclusion(input []byte, root []byte, inc *Inclusion, config *Config) (bool, error) {
+	if input == nil {
+		return false, ErrInputIsNil
+	}
+	if inc == nil || inc.Proof == nil {
+		return false, ErrProofIsNil
+	}
+
+	proof := inc.Proof
+	if config == nil {
+		config = proof.Config()
+	}
+	if !config.SealRoot {
+		return false, fmt.Errorf("%w: an inclusion requires SealRoot", ErrUnsupportedConfig)
+	}
+
+	if inc.Index < 0 || inc.Index >= inc.LeafCount ||
+		uint64(inc.Index) != proof.Index || inc.LeafCount != proof.LeafCount {
+		return false, nil
+	}
+
+	leaf, err := sproutLeaf(nil, input, newHashFunc(config), config.DomainSeperation)
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(leaf, inc.Leaf) {
+		return false, nil
+	}
+	return Verify(input, root, proof, config)
+}
@@ -0,0 +1,157 @@
+package merkletree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeafAndIndexOf(t *testing.T) {
+	t.Parallel()
+
+	input := generateRandomInputs(t, 7)
+	tree, err := New(&Config{DomainSeperation: true}, input)
+	require.NoError(t, err)
+
+	for i := range input {
+		leaf, err := tree.Leaf(i)
+		require.NoError(t, err)
+		assert.Equal(t, tree.Leaves[i], leaf)
+
+		index, err := tree.IndexOf(input[i])
+		require.NoError(t, err)
+		assert.Equal(t, i, index)
+	}
+
+	leaf, err := tree.Leaf(0)
+	require.NoError(t, err)
+	leaf[0] ^= 1
+	assert.NotEqual(t, tree.Leaves[0], leaf, "Leaf must return a copy")
+
+	_, err = tree.Leaf(7)
+	assert.ErrorIs(t, err, ErrProofInvalidIndex)
+	_, err = tree.IndexOf([]byte("missing"))
+	assert.ErrorIs(t, err, ErrProofInvalidLeaf)
+
+	require.NoError(t, tree.Update(3, []byte("updated")))
+	index, err := tree.IndexOf([]byte("updated"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, index)
+	_, err = tree.IndexOf(input[3])
+	assert.ErrorIs(t, err, ErrProofInvalidLeaf)
+}
+
+func TestVerifyInclusion(t *testing.T) {
+	t.Parallel()
+
+	t.Run("by index and by value", func(t *testing.T) {
+		for _, cfg := range []*Config{
+			{SealRoot: true},
+			{XXH128: true, DomainSeperation: true, SealRoot: true},
+			{Arity: 4, SealRoot: true},
+		} {
+			input := generateRandomInputs(t, 11)
+			tree, err := New(cfg, input)
+			require.NoError(t, err)
+
+			for i := range input {
+				inc, err := tree.Inclusion(i)
+				require.NoError(t, err)
+				assert.Equal(t, i, inc.Index)
+				assert.Equal(t, 11, inc.LeafCount)
+				assert.Equal(t, tree.Leaves[i], inc.Leaf)
+
+				byValue, err := tree.InclusionOf(input[i])
+				require.NoError(t, err)
+				assert.Equal(t, inc, byValue)
+
+				ok, err := VerifyInclusion(input[i], tree.Root, inc, cfg)
+				require.NoError(t, err)
+				assert.True(t, ok, "leaf %d", i)
+
+				ok, err = VerifyInclusion(input[i], tree.Root, inc, nil)
+				require.NoError(t, err)
+				assert.True(t, ok, "leaf %d, config from proof", i)
+			}
+		}
+	})
+
+	t.Run("rejects inconsistent fields", func(t *testing.T) {
+		input := generateRandomInputs(t, 6)
+		tree, err := New(&Config{SealRoot: true}, input)
+		require.NoError(t, err)
+
+		for name, tamper := range map[string]func(inc *Inclusion){
+			"index":          func(inc *Inclusion) { inc.Index = 3 },
+			"leaf count":     func(inc *Inclusion) { inc.LeafCount = 7 },
+			"both counts":    func(inc *Inclusion) { inc.LeafCount, inc.Proof.LeafCount = 5, 5 },
+			"leaf":           func(inc *Inclusion) { inc.Leaf = tree.Leaves[3] },
+			"index past end": func(inc *Inclusion) { inc.Index, inc.Proof.Index = 6, 6 },
+		} {
+			inc, err := tree.Inclusion(2)
+			require.NoError(t, err)
+			tamper(inc)
+			ok, err := VerifyInclusion(input[2], tree.Root, inc, nil)
+			require.NoError(t, err, name)
+			assert.False(t, ok, name)
+		}
+
+		inc, err := tree.Inclusion(2)
+		require.NoError(t, err)
+		ok, err := VerifyInclusion(input[3], tree.Root, inc, nil)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		// The padding copy of the last leaf cannot be claimed past the end.
+		inc, err = tree.Inclusion(5)
+		require.NoError(t, err)
+		inc.Index, inc.Proof.Index = 6, 6
+		inc.LeafCount, inc.Proof.LeafCount = 8, 8
+		ok, err = VerifyInclusion(input[5], tree.Root, inc, nil)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		_, err = VerifyInclusion(nil, tree.Root, inc, nil)
+		assert.ErrorIs(t, err, ErrInputIsNil)
+		_, err = VerifyInclusion(input[2], tree.Root, nil, nil)
+		assert.ErrorIs(t, err, ErrProofIsNil)
+		_, err = VerifyInclusion(input[2], tree.Root, &Inclusion{}, nil)
+		assert.ErrorIs(t, err, ErrProofIsNil)
+	})
+
+	t.Run("requires a sealed root", func(t *testing.T) {
+		input := generateRandomInputs(t, 5)
+		tree, err := New(nil, input)
+		require.NoError(t, err)
+
+		_, err = tree.Inclusion(4)
+		assert.ErrorIs(t, err, ErrUnsupportedConfig)
+		_, err = tree.InclusionOf(input[4])
+		assert.ErrorIs(t, err, ErrUnsupportedConfig)
+
+		proof4, err := tree.Proof(4)
+		require.NoError(t, err)
+		inc := &Inclusion{Leaf: tree.Leaves[4], Index: 4, LeafCount: 5, Proof: proof4}
+		_, err = VerifyInclusion(input[4], tree.Root, inc, nil)
+		assert.ErrorIs(t, err, ErrUnsupportedConfig)
+
+		// Unsealed, the last leaf's padding copy verifies at index 5 of a
+		// claimed 8-leaf tree, so the forgery must not be accepted.
+		forged := *inc
+		proof := *inc.Proof
+		forged.Proof = &proof
+		forged.Index, proof.Index = 5, 5
+		forged.LeafCount, proof.LeafCount = 8, 8
+		ok, err := Verify(input[4], tree.Root, &proof, nil)
+		require.NoError(t, err)
+		require.True(t, ok, "the forgery should fool a plain Verify")
+
+		ok, err = VerifyInclusion(input[4], tree.Root, &forged, nil)
+		assert.ErrorIs(t, err, ErrUnsupportedConfig)
+		assert.False(t, ok)
+		ok, err = VerifyInclusion(input[4], tree.Root, &forged, &Config{})
+		assert.ErrorIs(t, err, ErrUnsupportedConfig)
+		assert.False(t, ok)
+	})
+}
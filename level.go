@@ -0,0 +1,104 @@
+package merkletree
+
+// Number of nodes held by one storage page. Levels are split into pages so
+// that snapshots can share them and mutations copy only the pages they touch.
+const pageNodes = 256
+
+// level stores one tree level as pages of contiguous hashSize-wide nodes.
+// Every page but the last holds exactly pageNodes nodes.
+type level struct {
+	width int
+	// number of nodes, including the duplicate of an odd level
+	count int
+	pages [][]byte
+	// owner records the generation that may write each page in place; pages
+	// from an earlier generation are shared with a snapshot and copied first.
+	owner []uint64
+	gen   uint64
+}
+
+// newLevel splits a contiguous level buffer into pages without copying it.
+func newLevel(nodes []byte, width int) *level {
+	l := &level{width: width, count: len(nodes) / width}
+	pageBytes := pageNodes * width
+	for start := 0; start < len(nodes); start += pageBytes {
+		end := min(start+pageBytes, len(nodes))
+		l.pages = append(l.pages, nodes[start:end:end])
+	}
+	l.owner = make([]uint64, len(l.pages))
+	return l
+}
+
+// node returns the node at index, aliasing the level's storage.
+func (l *level) node(index int) []byte {
+	page := l.pages[index/pageNodes]
+	offset := (index % pageNodes) * l.width
+	return page[offset : offset+l.width : offset+l.width]
+}
+
+// set overwrites the node at index, or appends it when index equals count.
+func (l *level) set(index int, node []byte) {
+	p := index / pageNodes
+	if index == l.count {
+		if p == len(l.pages) {
+			l.pages = append(l.pages, make([]byte, 0, pageNodes*l.width))
+			l.owner = append(l.owner, l.gen)
+		}
+		l.own(p)
+		l.pages[p] = append(l.pages[p], node...)
+		l.count++
+		return
+	}
+
+	l.own(p)
+	copy(l.node(index), node)
+}
+
+// truncate drops the nodes from count onwards.
+func (l *level) truncate(count int) {
+	if count >= l.count {
+		return
+	}
+	pages := (count + pageNodes - 1) / pageNodes
+	l.pages, l.owner = l.pages[:pages], l.owner[:pages]
+	if rest := count % pageNodes; rest != 0 {
+		// A shared page keeps its contents; set copies it before appending.
+		l.pages[pages-1] = l.pages[pages-1][:rest*l.width]
+	}
+	l.count = count
+}
+
+// own makes page p writable in place, copying it if a snapshot shares it.
+func (l *level) own(p int) {
+	if l.owner[p] == l.gen {
+		return
+	}
+	page := make([]byte, len(l.pages[p]), pageNodes*l.width)
+	copy(page, l.pages[p])
+	l.pages[p] = page
+	l.owner[p] = l.gen
+}
+
+// freeze returns a read-only copy of the level that shares every page, and
+// starts a new generation so that later writes copy the shared pages.
+func (l *level) freeze() *level {
+	frozen := &level{
+		width: l.width,
+		count: l.count,
+		pages: append([][]byte(nil), l.pages...),
+	}
+	l.gen++
+	return frozen
+}
+
+// thaw returns a writable copy of a frozen level; all pages stay shared
+// until written.
+func (l *level) thaw() *level {
+	return &level{
+		width: l.width,
+		count: l.count,
+		pages: append([][]byte(nil), l.pages...),
+		owner: make([]uint64, len(l.pages)),
+		gen:   1,
+	}
+}
@@ -1,7 +1,10 @@
 package merkletree
 
 import (
-	"math/bits"
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
 )
 
 const (
@@ -10,25 +13,101 @@ const (
 )
 
 type TypeHashFunc func([]byte) ([]byte, error)
+
+// ProgressStage identifies the phase of tree construction reported to Config.Progress.
+type ProgressStage int
+
+const (
+	StageLeaves ProgressStage = iota // hashing the input data into leaves
+	StageGrow                        // hashing the internal levels and root
+)
+
+func (s ProgressStage) String() string {
+	switch s {
+	case StageLeaves:
+		return "leaves"
+	case StageGrow:
+		return "grow"
+	default:
+		return "unknown"
+	}
+}
+
+// ProgressFunc receives construction progress. level is the tree level being
+// produced (0 for leaves, Depth for the root); done and total count its hashes.
+type ProgressFunc func(stage ProgressStage, level, done, total int)
+
 type Config struct {
 	// If true, use 128-bit XXH hashing for tree building
 	XXH128 bool
 	// If true, an extra byte is prepended to all nodes to distinguish the domains of leaves and branches
 	DomainSeperation bool
+	// Seed for the xxh3 hash. Keeping it private stops whoever controls the
+	// inputs from crafting colliding leaves offline. It does not make the tree
+	// a MAC. The same seed is required to verify.
+	Seed uint64
+	// Optional secret prepended to every hashed message, a key longer than
+	// the 64-bit Seed against crafted collisions. It must also be kept private.
+	Secret []byte
+	// If true, the root also commits to the leaf count, hash width and domain
+	// separation flag, so proofs cannot be replayed against a differently-shaped tree.
+	SealRoot bool
+	// Store only every LevelInterval-th level of internal nodes (leaves are always
+	// kept); missing proof siblings are recomputed on demand. A value greater than
+	// the tree depth keeps only the leaves. 0 or 1 stores every level.
+	LevelInterval int
+	// Optional callback invoked periodically while the tree is built.
+	Progress ProgressFunc
+	// Number of children of every internal node, from 2 to 255. 0 selects a
+	// binary tree. Each proof level of a k-ary tree carries k-1 siblings, so a
+	// wider tree trades larger proofs for fewer levels and hash calls.
+	Arity int
+}
+
+// arity returns the fan-out of the tree.
+func (c *Config) arity() int {
+	if c.Arity == 0 {
+		return 2
+	}
+	return c.Arity
+}
+
+// validate rejects settings that cannot describe a tree.
+func (c *Config) validate() error {
+	if c.Arity != 0 && (c.Arity < 2 || c.Arity > 255) {
+		return fmt.Errorf("%w: got %d", ErrInvalidArity, c.Arity)
+	}
+	return nil
 }
 
+// MerkleTree is safe for concurrent use by many readers and a single writer:
+// Proof, ProofFromInput, ProofFromLeaf and CurrentRoot may be called from any
+// number of goroutines while Update or Append runs. The exported fields must
+// not be read directly while a mutation may be in flight; use CurrentRoot or
+// an immutable Snapshot instead. Proofs never alias the tree's storage.
 type MerkleTree struct {
 	*Config
+	// mu guards the nodes, leaves, leafMap and root against concurrent mutation.
+	mu sync.RWMutex
 	// Maps leaf nodes to their index in the tree's leaf level.
 	// This reverse-map is useful when generating proofs.
 	leafMap map[string]int
+	// leafDups counts, for leaf nodes held by several leaves, the leaves
+	// beyond the one recorded in leafMap.
+	leafDups map[string]int
 	// hash function used for tree building.
-	hashFunc TypeHashFunc
-	// nodes contains the Merkle Tree's internal node structure.
-	nodes [][][]byte
+	hashFunc appendHashFunc
+	// native enables the allocation-free xxh3 path, which is only equivalent to
+	// hashFunc for plain seeded xxh3 (no Secret).
+	native bool
+	// nodes contains the Merkle Tree's internal node structure, one paged level
+	// of hashSize-wide nodes per tree level. Leaves alias the first level.
+	nodes []*level
+	// versions records the snapshots taken of this tree, keyed by root.
+	versions *versionIndex
 
 	// Merkle root node hash.
-	Root []byte
+	Root Root
 	// Hashes of the raw input data for the Merkle leaves.
 	Leaves [][]byte
 	// Depth of the Merkle tree.
@@ -39,35 +118,96 @@ type MerkleTree struct {
 
 // New generates a new Merkle Tree with the specified configuration and leaf inputs.
 func New(config *Config, input [][]byte) (*MerkleTree, error) {
+	return NewWithContext(context.Background(), config, input)
+}
+
+// NewWithContext is like New but stops building once ctx is done, returning ctx.Err()
+// and no tree.
+func NewWithContext(ctx context.Context, config *Config, input [][]byte) (*MerkleTree, error) {
 	if len(input) <= 1 {
-		return nil, ErrInvalidNumOfLeaves
+		return nil, leafCountError(len(input))
 	}
 	if config == nil {
 		config = new(Config)
 	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
 
 	m := &MerkleTree{
 		Config:    config,
 		LeafCount: len(input),
-		Depth:     bits.Len(uint(len(input) - 1)),
+		Depth:     treeDepth(len(input), config.arity()),
 	}
 
-	if config.XXH128 {
-		m.hashFunc = xxh3Hash128
-	} else {
-		m.hashFunc = xxh3Hash64
-	}
+	m.hashFunc = newHashFunc(config)
+	m.native = len(config.Secret) == 0
 
 	var err error
 	// generate leaves
 	m.leafMap = make(map[string]int)
-	m.Leaves, err = m.computeLeafNodes(input)
+	m.Leaves, err = m.computeLeafNodes(ctx, input)
 	if err != nil {
 		return nil, err
 	}
-	if err := m.grow(); err != nil {
+	if err := m.grow(ctx); err != nil {
 		return nil, err
 	}
 
 	return m, nil
 }
+
+// RootFrom computes the root of the tree over the inputs read from src. The
+// inputs are hashed as they are read and never held, so only the leaf hashes
+// and internal levels are kept in memory while the root is computed.
+func RootFrom(ctx context.Context, config *Config, src LeafSource) (Root, error) {
+	if config == nil {
+		config = new(Config)
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	m := &MerkleTree{
+		Config:   config,
+		hashFunc: newHashFunc(config),
+		native:   len(config.Secret) == 0,
+	}
+
+	var (
+		buf bytes.Buffer
+		err error
+	)
+	if m.LeafCount, err = m.spillLeaves(ctx, src, &buf); err != nil {
+		return nil, err
+	}
+	if m.LeafCount <= 1 {
+		return nil, leafCountError(m.LeafCount)
+	}
+	m.Depth = treeDepth(m.LeafCount, config.arity())
+
+	width, leaves := m.hashSize(), buf.Bytes()
+	m.Leaves = make([][]byte, m.LeafCount)
+	for i := range m.Leaves {
+		m.Leaves[i] = leaves[i*width : (i+1)*width]
+	}
+	if err := m.grow(ctx); err != nil {
+		return nil, err
+	}
+	return m.Root, nil
+}
+
+// hashSize returns the width in bytes of the tree's node hashes.
+func (m *MerkleTree) hashSize() int {
+	if m.XXH128 {
+		return 16
+	}
+	return 8
+}
+
+// CurrentRoot returns a copy of the root, synchronized with Update.
+func (m *MerkleTree) CurrentRoot() Root {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return bytes.Clone(m.Root)
+}
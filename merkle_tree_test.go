@@ -1,7 +1,9 @@
 package merkletree
 
 import (
+	"context"
 	"crypto/rand"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -129,4 +131,125 @@ func TestNew(t *testing.T) {
 			assert.Equal(t, i, idx, "wrong index in leafMap for leaf %d", i)
 		}
 	})
+
+	t.Run("Seed and Secret key the tree", func(t *testing.T) {
+		input := generateRandomInputs(t, 5)
+
+		plain, err := New(nil, input)
+		require.NoError(t, err)
+
+		seeded, err := New(&Config{Seed: 42}, input)
+		require.NoError(t, err)
+		assert.NotEqual(t, plain.Root, seeded.Root, "seed should change the root")
+
+		otherSeed, err := New(&Config{Seed: 43}, input)
+		require.NoError(t, err)
+		assert.NotEqual(t, seeded.Root, otherSeed.Root, "different seeds should give different roots")
+
+		keyed, err := New(&Config{Seed: 42, Secret: []byte("deployment-key")}, input)
+		require.NoError(t, err)
+		assert.NotEqual(t, seeded.Root, keyed.Root, "secret should change the root")
+
+		again, err := New(&Config{Seed: 42, Secret: []byte("deployment-key")}, input)
+		require.NoError(t, err)
+		assert.Equal(t, keyed.Root, again.Root, "keyed trees should be deterministic")
+	})
+}
+
+func TestNewWithContext(t *testing.T) {
+	t.Parallel()
+
+	t.Run("matches New when not cancelled", func(t *testing.T) {
+		input := generateRandomInputs(t, 9)
+		tree, err := New(nil, input)
+		require.NoError(t, err)
+
+		ctxTree, err := NewWithContext(context.Background(), nil, input)
+		require.NoError(t, err)
+		assert.Equal(t, tree.Root, ctxTree.Root)
+	})
+
+	t.Run("returns ctx error and no tree when cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		tree, err := NewWithContext(ctx, nil, generateRandomInputs(t, 4))
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Nil(t, tree)
+	})
+
+	t.Run("grow stops when cancelled", func(t *testing.T) {
+		input := generateRandomInputs(t, 4)
+		tree, err := New(nil, input)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.ErrorIs(t, tree.grow(ctx), context.Canceled)
+	})
+}
+
+// nodeBytes approximates the heap retained by the tree's stored levels.
+func nodeBytes(m *MerkleTree) int {
+	const sliceHeader = 24
+	total := 0
+	for _, level := range m.nodes {
+		if level == nil {
+			continue
+		}
+		for _, page := range level.pages {
+			total += sliceHeader + len(page)
+		}
+	}
+	return total
+}
+
+func BenchmarkNew_LevelInterval(b *testing.B) {
+	input := make([][]byte, 1<<16)
+	for i := range input {
+		input[i] = []byte{byte(i), byte(i >> 8), byte(i >> 16)}
+	}
+
+	for _, interval := range []int{1, 2, 4, 64} {
+		b.Run(fmt.Sprintf("interval=%d", interval), func(b *testing.B) {
+			b.ReportAllocs()
+			var tree *MerkleTree
+			for i := 0; i < b.N; i++ {
+				var err error
+				if tree, err = New(&Config{LevelInterval: interval}, input); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(nodeBytes(tree)), "node-bytes")
+		})
+	}
+}
+
+func TestRootFrom(t *testing.T) {
+	t.Parallel()
+
+	for _, cfg := range []*Config{
+		nil,
+		{DomainSeperation: true, SealRoot: true},
+		{XXH128: true, Seed: 2, Secret: []byte("key")},
+		{Arity: 5},
+	} {
+		for _, n := range []int{2, 9, 100} {
+			input := generateRandomInputs(t, n)
+			tree, err := New(cfg, input)
+			require.NoError(t, err)
+
+			root, err := RootFrom(context.Background(), cfg, SliceSource(input))
+			require.NoError(t, err)
+			assert.Equal(t, tree.Root, root, "%d leaves", n)
+		}
+	}
+
+	_, err := RootFrom(context.Background(), nil, SliceSource(generateRandomInputs(t, 1)))
+	assert.ErrorIs(t, err, ErrInvalidNumOfLeaves)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = RootFrom(ctx, nil, SliceSource(generateRandomInputs(t, 4)))
+	assert.ErrorIs(t, err, context.Canceled)
 }
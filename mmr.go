@@ -0,0 +1,363 @@
+package merkletree
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+	"sync"
+)
+
+// MMR is a Merkle Mountain Range: an append-only accumulator made of perfect
+// binary trees ("peaks") of strictly decreasing height. Nodes are numbered in
+// the order they are appended, leaves and parents interleaved, so the nodes of
+// an earlier size are a prefix of the current ones and every historical root
+// and proof can still be produced. Leaves and parents are hashed exactly like
+// those of a MerkleTree; the root bags the peaks from right to left.
+//
+// An MMR is safe for concurrent use by many readers and a single writer.
+type MMR struct {
+	*Config
+	mu       sync.RWMutex
+	hashFunc appendHashFunc
+	// nodes holds every node hash, hashSize wide, in position order.
+	nodes     []byte
+	size      uint64
+	leafCount uint64
+}
+
+// MMRProof proves the inclusion of a leaf in an MMR of a given size.
+type MMRProof struct {
+	// Position of the leaf among all nodes.
+	Pos uint64
+	// Number of nodes in the MMR the proof was generated from.
+	Size uint64
+	// Siblings on the path from the leaf to its peak, lowest first.
+	Siblings [][]byte
+	// Every other peak, left to right.
+	Peaks [][]byte
+}
+
+// NewMMR returns an empty MMR. SealRoot is not supported, as the root of a
+// single peak is the peak itself, and neither is an arity other than 2.
+func NewMMR(config *Config) (*MMR, error) {
+	if config == nil {
+		config = new(Config)
+	}
+	if config.SealRoot {
+		return nil, fmt.Errorf("%w: SealRoot", ErrUnsupportedConfig)
+	}
+	if config.arity() != 2 {
+		return nil, fmt.Errorf("%w: Arity %d", ErrUnsupportedConfig, config.Arity)
+	}
+	return &MMR{Config: config, hashFunc: newHashFunc(config)}, nil
+}
+
+func (m *MMR) hashSize() int {
+	if m.XXH128 {
+		return 16
+	}
+	return 8
+}
+
+// Size returns the number of nodes, leaves and parents, in the MMR.
+func (m *MMR) Size() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.size
+}
+
+// LeafCount returns the number of leaves appended to the MMR.
+func (m *MMR) LeafCount() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.leafCount
+}
+
+// Append adds a leaf for input, merging equal-height peaks, and returns the
+// leaf's position.
+func (m *MMR) Append(input []byte) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	width := m.hashSize()
+	nodes, err := sproutLeaf(m.nodes, input, m.hashFunc, m.DomainSeperation)
+	if err != nil {
+		return 0, err
+	}
+	pos := m.size
+	size := pos + 1
+
+	var raw []byte
+	for height := 0; mmrHeight(size) > height; height++ {
+		left, right := size-(2<<height), size-1
+		raw = appendNodeInput(raw[:0], nodes[left*uint64(width):(left+1)*uint64(width)], nodes[right*uint64(width):], m.DomainSeperation)
+		if nodes, err = m.hashFunc(nodes, raw); err != nil {
+			return 0, err
+		}
+		size++
+	}
+
+	m.nodes, m.size = nodes, size
+	m.leafCount++
+	return pos, nil
+}
+
+// Root returns the root of the MMR.
+func (m *MMR) Root() (Root, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.rootAt(m.size)
+}
+
+// RootAt returns the root the MMR had when it held size nodes.
+func (m *MMR) RootAt(size uint64) (Root, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.rootAt(size)
+}
+
+func (m *MMR) rootAt(size uint64) (Root, error) {
+	if size == 0 || size > m.size || !validMMRSize(size) {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidMMRSize, size)
+	}
+	peaks := mmrPeaks(size)
+	hashes := make([][]byte, len(peaks))
+	for i, pos := range peaks {
+		hashes[i] = m.node(pos)
+	}
+	root, err := bagPeaks(hashes, m.hashFunc, m.DomainSeperation)
+	return root, err
+}
+
+// Proof generates the proof for the leaf at pos against the current root.
+func (m *MMR) Proof(pos uint64) (*MMRProof, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.proofAt(pos, m.size)
+}
+
+// ProofAt generates the proof for the leaf at pos against the root the MMR
+// had when it held size nodes.
+func (m *MMR) ProofAt(pos, size uint64) (*MMRProof, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.proofAt(pos, size)
+}
+
+// UpgradeProof returns the proof for the same leaf as an earlier proof, but
+// against the current root. It fails with ErrProofMismatch unless the earlier
+// proof was generated from this MMR.
+func (m *MMR) UpgradeProof(proof *MMRProof) (*MMRProof, error) {
+	if proof == nil {
+		return nil, ErrProofIsNil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	old, err := m.proofAt(proof.Pos, proof.Size)
+	if err != nil {
+		return nil, err
+	}
+	if !equalHashes(old.Siblings, proof.Siblings) || !equalHashes(old.Peaks, proof.Peaks) {
+		return nil, ErrProofMismatch
+	}
+	return m.proofAt(proof.Pos, m.size)
+}
+
+func (m *MMR) proofAt(pos, size uint64) (*MMRProof, error) {
+	if size == 0 || size > m.size || !validMMRSize(size) {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidMMRSize, size)
+	}
+	if pos >= size || mmrHeight(pos) != 0 {
+		return nil, fmt.Errorf("%w: %d is not a leaf position", ErrProofInvalidIndex, pos)
+	}
+
+	proof := &MMRProof{Pos: pos, Size: size}
+	peak := pos
+	for height := 0; ; height++ {
+		sibling, parent, ok := mmrParent(peak, height, size)
+		if !ok {
+			break
+		}
+		proof.Siblings = append(proof.Siblings, bytes.Clone(m.node(sibling)))
+		peak = parent
+	}
+	for _, p := range mmrPeaks(size) {
+		if p != peak {
+			proof.Peaks = append(proof.Peaks, bytes.Clone(m.node(p)))
+		}
+	}
+	return proof, nil
+}
+
+// node returns the hash at pos, aliasing the MMR's storage.
+func (m *MMR) node(pos uint64) []byte {
+	width := uint64(m.hashSize())
+	return m.nodes[pos*width : (pos+1)*width : (pos+1)*width]
+}
+
+// VerifyMMR checks that input is the leaf proven by proof against an MMR root.
+func VerifyMMR(input []byte, root []byte, proof *MMRProof, config *Config) (bool, error) {
+	if input == nil {
+		return false, ErrInputIsNil
+	}
+	if proof == nil {
+		return false, ErrProofIsNil
+	}
+	if config == nil {
+		config = new(Config)
+	}
+	if config.SealRoot {
+		return false, fmt.Errorf("%w: SealRoot", ErrUnsupportedConfig)
+	}
+	if config.arity() != 2 {
+		return false, fmt.Errorf("%w: Arity %d", ErrUnsupportedConfig, config.Arity)
+	}
+	if !validMMRSize(proof.Size) || proof.Pos >= proof.Size || mmrHeight(proof.Pos) != 0 {
+		return false, nil
+	}
+
+	width := 8
+	if config.XXH128 {
+		width = 16
+	}
+	for level, sib := range proof.Siblings {
+		if len(sib) != width {
+			return false, &SiblingLengthError{Level: level, Got: len(sib), Want: width}
+		}
+	}
+
+	hashFunc := newHashFunc(config)
+	result, err := sproutLeaf(nil, input, hashFunc, config.DomainSeperation)
+	if err != nil {
+		return false, err
+	}
+
+	var combined []byte
+	peak := proof.Pos
+	for height := 0; ; height++ {
+		_, parent, ok := mmrParent(peak, height, proof.Size)
+		if !ok {
+			break
+		}
+		if height >= len(proof.Siblings) {
+			return false, nil
+		}
+		sib := proof.Siblings[height]
+		if parent == peak+1 {
+			// right child
+			combined = appendNodeInput(combined[:0], sib, result, config.DomainSeperation)
+		} else {
+			combined = appendNodeInput(combined[:0], result, sib, config.DomainSeperation)
+		}
+		if result, err = hashFunc(result[:0], combined); err != nil {
+			return false, err
+		}
+		peak = parent
+	}
+
+	peaks := mmrPeaks(proof.Size)
+	if len(proof.Siblings) != mmrHeight(peak) || len(proof.Peaks) != len(peaks)-1 {
+		return false, nil
+	}
+	hashes := make([][]byte, 0, len(peaks))
+	for i, rest := 0, proof.Peaks; i < len(peaks); i++ {
+		if peaks[i] == peak {
+			hashes = append(hashes, result)
+			continue
+		}
+		hashes, rest = append(hashes, rest[0]), rest[1:]
+	}
+
+	bagged, err := bagPeaks(hashes, hashFunc, config.DomainSeperation)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(bagged, root), nil
+}
+
+// bagPeaks folds the peaks into a root from right to left.
+func bagPeaks(peaks [][]byte, hashFunc appendHashFunc, domainSeparation bool) (Root, error) {
+	root := bytes.Clone(peaks[len(peaks)-1])
+	var raw []byte
+	for i := len(peaks) - 2; i >= 0; i-- {
+		raw = appendNodeInput(raw[:0], peaks[i], root, domainSeparation)
+		var err error
+		if root, err = hashFunc(root[:0], raw); err != nil {
+			return nil, err
+		}
+	}
+	return root, nil
+}
+
+// mmrHeight returns the height of the node at pos, leaves being at height 0.
+func mmrHeight(pos uint64) int {
+	pos++
+	// Jump left until pos is the root of a perfect tree, whose 1-based
+	// position is all ones.
+	for pos&(pos+1) != 0 {
+		pos -= 1<<(bits.Len64(pos)-1) - 1
+	}
+	return bits.Len64(pos) - 1
+}
+
+// mmrParent returns the sibling and parent of the node at pos of the given
+// height, or false if pos is a peak of an MMR with size nodes.
+func mmrParent(pos uint64, height int, size uint64) (sibling, parent uint64, ok bool) {
+	if mmrHeight(pos+1) > height {
+		// right child; its parent directly follows it
+		sibling, parent = pos+1-(2<<height), pos+1
+	} else {
+		sibling = pos + (2 << height) - 1
+		parent = sibling + 1
+	}
+	return sibling, parent, parent < size
+}
+
+// mmrPeaks returns the positions of the peaks of an MMR with size nodes, left
+// to right.
+func mmrPeaks(size uint64) []uint64 {
+	var (
+		peaks  []uint64
+		offset uint64
+	)
+	for size > 0 {
+		tree := uint64(1)<<(bits.Len64(size+1)-1) - 1
+		peaks = append(peaks, offset+tree-1)
+		offset += tree
+		size -= tree
+	}
+	return peaks
+}
+
+// validMMRSize reports whether an MMR can hold exactly size nodes, i.e. size
+// splits into perfect trees of strictly decreasing height.
+func validMMRSize(size uint64) bool {
+	if size == 0 {
+		return false
+	}
+	prev := 65
+	for size > 0 {
+		height := bits.Len64(size+1) - 1
+		if height >= prev {
+			return false
+		}
+		prev = height
+		size -= 1<<height - 1
+	}
+	return true
+}
+
+// equalHashes reports whether two lists of hashes are identical.
+func equalHashes(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,154 @@
+package merkletree
+
+import (
+	"math/bits"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// referenceMMRRoot bags the roots of perfect MerkleTrees built over the
+// leaves of each peak.
+func referenceMMRRoot(t *testing.T, cfg *Config, input [][]byte) Root {
+	var peaks [][]byte
+	for rest := input; len(rest) > 0; {
+		n := 1 << (bits.Len(uint(len(rest))) - 1)
+		if n == 1 {
+			leaf, err := sproutLeaf(nil, rest[0], newHashFunc(cfg), cfg.DomainSeperation)
+			require.NoError(t, err)
+			peaks = append(peaks, leaf)
+		} else {
+			tree, err := New(cfg, rest[:n])
+			require.NoError(t, err)
+			peaks = append(peaks, tree.Root)
+		}
+		rest = rest[n:]
+	}
+	root, err := bagPeaks(peaks, newHashFunc(cfg), cfg.DomainSeperation)
+	require.NoError(t, err)
+	return root
+}
+
+func TestMMR(t *testing.T) {
+	t.Parallel()
+
+	t.Run("positions and peaks", func(t *testing.T) {
+		heights := []int{0, 0, 1, 0, 0, 1, 2, 0, 0, 1, 0, 0, 1, 2, 3, 0}
+		for pos, want := range heights {
+			assert.Equal(t, want, mmrHeight(uint64(pos)), "pos %d", pos)
+		}
+		assert.Equal(t, []uint64{6, 9, 10}, mmrPeaks(11))
+		assert.True(t, validMMRSize(11))
+		assert.False(t, validMMRSize(2))
+		assert.False(t, validMMRSize(0))
+	})
+
+	t.Run("roots and proofs match perfect trees", func(t *testing.T) {
+		for _, cfg := range []*Config{
+			{},
+			{DomainSeperation: true},
+			{XXH128: true, Seed: 7, Secret: []byte("key")},
+		} {
+			mmr, err := NewMMR(cfg)
+			require.NoError(t, err)
+
+			input := generateRandomInputs(t, 19)
+			var positions []uint64
+			for i, data := range input {
+				pos, err := mmr.Append(data)
+				require.NoError(t, err)
+				positions = append(positions, pos)
+				assert.Equal(t, uint64(i+1), mmr.LeafCount())
+
+				root, err := mmr.Root()
+				require.NoError(t, err)
+				assert.Equal(t, referenceMMRRoot(t, cfg, input[:i+1]), root, "%d leaves", i+1)
+
+				for j := 0; j <= i; j++ {
+					proof, err := mmr.Proof(positions[j])
+					require.NoError(t, err)
+					ok, err := VerifyMMR(input[j], root, proof, cfg)
+					require.NoError(t, err)
+					assert.True(t, ok, "leaf %d of %d", j, i+1)
+
+					ok, err = VerifyMMR(input[(j+1)%len(input)], root, proof, cfg)
+					require.NoError(t, err)
+					assert.False(t, ok)
+				}
+			}
+		}
+	})
+
+	t.Run("historical proofs stay valid and upgrade", func(t *testing.T) {
+		mmr, err := NewMMR(nil)
+		require.NoError(t, err)
+		input := generateRandomInputs(t, 11)
+		for _, data := range input[:5] {
+			_, err := mmr.Append(data)
+			require.NoError(t, err)
+		}
+		oldSize := mmr.Size()
+		oldRoot, err := mmr.Root()
+		require.NoError(t, err)
+		old, err := mmr.Proof(3)
+		require.NoError(t, err)
+
+		for _, data := range input[5:] {
+			_, err := mmr.Append(data)
+			require.NoError(t, err)
+		}
+
+		root, err := mmr.RootAt(oldSize)
+		require.NoError(t, err)
+		assert.Equal(t, oldRoot, root)
+
+		historical, err := mmr.ProofAt(3, oldSize)
+		require.NoError(t, err)
+		assert.Equal(t, old, historical)
+		ok, err := VerifyMMR(input[2], oldRoot, old, nil)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		upgraded, err := mmr.UpgradeProof(old)
+		require.NoError(t, err)
+		assert.Equal(t, mmr.Size(), upgraded.Size)
+		assert.Equal(t, old.Siblings, upgraded.Siblings[:len(old.Siblings)])
+		root, err = mmr.Root()
+		require.NoError(t, err)
+		ok, err = VerifyMMR(input[2], root, upgraded, nil)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		forged := *old
+		forged.Siblings = [][]byte{make([]byte, 8), old.Siblings[1]}
+		_, err = mmr.UpgradeProof(&forged)
+		assert.ErrorIs(t, err, ErrProofMismatch)
+	})
+
+	t.Run("rejects invalid arguments", func(t *testing.T) {
+		_, err := NewMMR(&Config{SealRoot: true})
+		assert.ErrorIs(t, err, ErrUnsupportedConfig)
+
+		mmr, err := NewMMR(nil)
+		require.NoError(t, err)
+		_, err = mmr.Root()
+		assert.ErrorIs(t, err, ErrInvalidMMRSize)
+
+		for _, data := range generateRandomInputs(t, 3) {
+			_, err := mmr.Append(data)
+			require.NoError(t, err)
+		}
+		_, err = mmr.Proof(2)
+		assert.ErrorIs(t, err, ErrProofInvalidIndex, "position 2 is a parent")
+		_, err = mmr.ProofAt(0, 2)
+		assert.ErrorIs(t, err, ErrInvalidMMRSize)
+		_, err = mmr.ProofAt(0, 7)
+		assert.ErrorIs(t, err, ErrInvalidMMRSize)
+
+		_, err = VerifyMMR(nil, nil, &MMRProof{}, nil)
+		assert.ErrorIs(t, err, ErrInputIsNil)
+		_, err = VerifyMMR([]byte("x"), nil, nil, nil)
+		assert.ErrorIs(t, err, ErrProofIsNil)
+	})
+}
@@ -1,15 +1,29 @@
 package merkletree
 
-import "errors"
+import "fmt"
 
 type Proof struct {
 	Siblings [][]byte
 	Index    uint64
+	// Number of leaves in the tree the proof was generated from.
+	LeafCount int
+	// Hash algorithm, domain separation and sealing mode of that tree.
+	XXH128           bool
+	DomainSeperation bool
+	SealRoot         bool
+	// Arity of that tree, 0 for a binary tree. Each level of a k-ary proof
+	// holds k-1 consecutive siblings, in child order without the node itself;
+	// the node's position at each level is a base-k digit of Index.
+	Arity int
+	// Omitted marks the siblings left out of a compact proof, one bit per
+	// sibling of the full proof, least significant bit first. An omitted
+	// sibling equals the child before it. Nil for a full proof.
+	Omitted []byte
 }
 
 // Generates the Merkle proof for a leaf input using the previously generated Merkle tree structure.
 func (m *MerkleTree) ProofFromInput(input []byte) (*Proof, error) {
-	leaf, err := sproutLeaf(input, m.hashFunc, m.DomainSeperation)
+	leaf, err := sproutLeaf(nil, input, m.hashFunc, m.DomainSeperation)
 	if err != nil {
 		return nil, err
 	}
@@ -17,51 +31,164 @@ func (m *MerkleTree) ProofFromInput(input []byte) (*Proof, error) {
 }
 
 func (m *MerkleTree) ProofFromLeaf(leaf []byte) (*Proof, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	idx, ok := m.leafMap[string(leaf)]
 	if !ok {
 		return nil, ErrProofInvalidLeaf
 	}
-	return m.Proof(idx)
+	return m.proof(idx)
 }
 
 func (m *MerkleTree) Proof(index int) (*Proof, error) {
-	var (
-		path     uint64
-		siblings = make([][]byte, m.Depth)
-	)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.proof(index)
+}
 
-	currentIdx := index
-	for level := 0; level < m.Depth; level++ {
-		levelNodes := m.nodes[level]
-		levelLen := len(levelNodes)
-
-		var siblingIdx int
-		isRightChild := currentIdx&1 == 1
-
-		if isRightChild {
-			path |= (1 << level) // bit 1 = right child (sibling left)
-			siblingIdx = currentIdx - 1
-		} else {
-			// left child (bit 0 = sibling right)
-			siblingIdx = currentIdx + 1
+func (m *MerkleTree) proof(index int) (*Proof, error) {
+	if index < 0 || index >= m.LeafCount {
+		return nil, indexError(index, m.LeafCount)
+	}
+	return buildProof(index, m.LeafCount, m.Depth, m.Config, m.nodeAt)
+}
+
+// ProofFromLeaves generates the proof for the leaf at index from the leaf
+// hashes of a tree alone, such as MerkleTree.Leaves, without its internal
+// nodes. Only the subtrees whose roots are siblings on the path are hashed.
+func ProofFromLeaves(leaves [][]byte, index int, config *Config) (*Proof, error) {
+	if len(leaves) <= 1 {
+		return nil, leafCountError(len(leaves))
+	}
+	if index < 0 || index >= len(leaves) {
+		return nil, indexError(index, len(leaves))
+	}
+	if config == nil {
+		config = new(Config)
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	width := 8
+	if config.XXH128 {
+		width = 16
+	}
+	for i, leaf := range leaves {
+		if len(leaf) != width {
+			return nil, fmt.Errorf("%w: leaf %d has %d bytes, want %d", ErrHashSize, i, len(leaf), width)
 		}
+	}
+
+	s := &subtreeHasher{leaves: leaves, config: config, hashFunc: newHashFunc(config)}
+	return buildProof(index, len(leaves), treeDepth(len(leaves), config.arity()), config, s.nodeAt)
+}
+
+// subtreeHasher computes internal nodes from the leaf hashes alone.
+type subtreeHasher struct {
+	leaves   [][]byte
+	config   *Config
+	hashFunc appendHashFunc
+}
+
+// nodeAt hashes the subtree rooted at the given level and index. Indices past
+// the end of a level resolve to its last node, like the padding of a tree.
+func (s *subtreeHasher) nodeAt(level, index int) ([]byte, error) {
+	k := s.config.arity()
+	count := levelCount(len(s.leaves), level, k)
+	index = min(index, count-1)
+	if level == 0 {
+		return s.leaves[index], nil
+	}
 
-		// Handle duplication edge case: if siblingIdx points to a duplicate (same as current)
-		// In duplicate style, this happens when currentIdx is the original last odd index,
-		// but since nodes[level] already has duplicate appended, sibling is valid and equal to leaf
-		if siblingIdx >= levelLen {
-			// This should NOT happen with duplication — but safety check
-			return nil, errors.New("sibling index out of bounds - duplication bug?")
+	var (
+		children   []byte
+		last       []byte
+		childCount = levelCount(len(s.leaves), level-1, k)
+	)
+	for c := k * index; c < k*(index+1); c++ {
+		// Padding copies are appended again rather than rehashed.
+		if c < childCount {
+			child, err := s.nodeAt(level-1, c)
+			if err != nil {
+				return nil, err
+			}
+			last = child
 		}
+		children = append(children, last...)
+	}
+	return s.hashFunc(nil, appendChildrenInput(nil, children, s.config.DomainSeperation))
+}
 
-		siblings[level] = levelNodes[siblingIdx]
+// buildProof collects the siblings on the path from a leaf to the root, reading
+// each one through nodeAt. The siblings are copied into a single buffer owned
+// by the proof.
+func buildProof(index, leafCount, depth int, config *Config, nodeAt func(level, index int) ([]byte, error)) (*Proof, error) {
+	k := config.arity()
+	var (
+		siblings = make([][]byte, 0, depth*(k-1))
+		buf      []byte
+	)
+
+	currentIdx := index
+	for level := 0; level < depth; level++ {
+		// For a binary tree the single sibling is on the left of a right
+		// child (odd index) and on the right of a left child.
+		first := currentIdx - currentIdx%k
+		for siblingIdx := first; siblingIdx < first+k; siblingIdx++ {
+			if siblingIdx == currentIdx {
+				continue
+			}
+			// Siblings past the end of the level are padding copies of its
+			// last node, which nodeAt resolves to the node itself.
+			sibling, err := nodeAt(level, siblingIdx)
+			if err != nil {
+				return nil, err
+			}
+			siblings = append(siblings, sibling)
+			buf = append(buf, sibling...)
+		}
 
 		// For next level: parent index
-		currentIdx >>= 1
+		currentIdx /= k
+	}
+
+	for i, offset := 0, 0; i < len(siblings); i++ {
+		end := offset + len(siblings[i])
+		siblings[i] = buf[offset:end:end]
+		offset = end
 	}
 
 	return &Proof{
-		Index:    path,
-		Siblings: siblings,
+		Index:            uint64(index),
+		Siblings:         siblings,
+		LeafCount:        leafCount,
+		XXH128:           config.XXH128,
+		DomainSeperation: config.DomainSeperation,
+		SealRoot:         config.SealRoot,
+		Arity:            config.Arity,
 	}, nil
 }
+
+// nodeAt returns the node at the given level and index. Levels dropped by
+// LevelInterval are recomputed on demand from the nearest stored level below.
+func (m *MerkleTree) nodeAt(level, index int) ([]byte, error) {
+	if l := m.nodes[level]; l != nil {
+		if index >= l.count {
+			index = l.count - 1
+		}
+		return l.node(index), nil
+	}
+
+	if count := levelCount(m.LeafCount, level, m.arity()); index >= count {
+		// padding copy of the last node
+		index = count - 1
+	}
+
+	children, err := m.children(level, index)
+	if err != nil {
+		return nil, err
+	}
+	return m.hashNode(children)
+}
@@ -2,6 +2,9 @@ package merkletree
 
 import (
 	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -88,6 +91,11 @@ func TestProof(t *testing.T) {
 		tamperedProof.Siblings[0] = bytes.Repeat([]byte{0xAA}, 32) // arbitrary tamper
 
 		ok, err := tree.Verify(input[0], tree.Root, tamperedProof, nil)
+		assert.ErrorIs(t, err, ErrSiblingLength)
+		assert.False(t, ok, "should fail with tampered sibling")
+
+		tamperedProof.Siblings[0] = bytes.Repeat([]byte{0xAA}, len(proof.Siblings[0]))
+		ok, err = tree.Verify(input[0], tree.Root, tamperedProof, nil)
 		require.NoError(t, err)
 		assert.False(t, ok, "should fail with tampered sibling")
 	})
@@ -122,4 +130,199 @@ func TestProof(t *testing.T) {
 			assert.True(t, proof.Index < (1<<tree.Depth), "path too large")
 		}
 	})
+
+	t.Run("rejects out of range index", func(t *testing.T) {
+		tree, err := New(nil, generateRandomInputs(t, 4))
+		require.NoError(t, err)
+
+		for _, idx := range []int{-1, 4} {
+			proof, err := tree.Proof(idx)
+			assert.ErrorIs(t, err, ErrProofInvalidIndex)
+			assert.Nil(t, proof)
+		}
+	})
+
+	t.Run("lean trees produce identical proofs", func(t *testing.T) {
+		for _, n := range []int{2, 3, 5, 8, 13, 17} {
+			input := generateRandomInputs(t, n)
+			full, err := New(&Config{DomainSeperation: true}, input)
+			require.NoError(t, err)
+
+			for _, interval := range []int{2, 3, 64} {
+				lean, err := New(&Config{DomainSeperation: true, LevelInterval: interval}, input)
+				require.NoError(t, err)
+				assert.Equal(t, full.Root, lean.Root, "root mismatch for %d leaves, interval %d", n, interval)
+
+				for i := range input {
+					want, err := full.Proof(i)
+					require.NoError(t, err)
+					got, err := lean.Proof(i)
+					require.NoError(t, err)
+					assert.Equal(t, want, got, "proof mismatch for leaf %d of %d, interval %d", i, n, interval)
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkProof_LevelInterval(b *testing.B) {
+	input := make([][]byte, 1<<14)
+	for i := range input {
+		input[i] = []byte{byte(i), byte(i >> 8), byte(i >> 16)}
+	}
+
+	for _, interval := range []int{1, 2, 4, 64} {
+		tree, err := New(&Config{LevelInterval: interval}, input)
+		require.NoError(b, err)
+
+		b.Run(fmt.Sprintf("interval=%d", interval), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := tree.Proof(i % len(input)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestProof_Arity(t *testing.T) {
+	t.Parallel()
+
+	t.Run("proofs verify for every leaf", func(t *testing.T) {
+		for _, cfg := range []*Config{
+			{Arity: 3},
+			{Arity: 16, DomainSeperation: true},
+			{Arity: 4, XXH128: true, SealRoot: true, LevelInterval: 2},
+		} {
+			for _, n := range []int{2, 7, 16, 40} {
+				input := generateRandomInputs(t, n)
+				tree, err := New(cfg, input)
+				require.NoError(t, err)
+				v := NewVerifier(tree.Root, cfg)
+
+				for i := range input {
+					proof, err := tree.Proof(i)
+					require.NoError(t, err)
+					assert.Len(t, proof.Siblings, tree.Depth*(cfg.Arity-1))
+					assert.Equal(t, cfg.Arity, proof.Arity)
+
+					ok, err := Verify(input[i], tree.Root, proof, nil)
+					require.NoError(t, err)
+					assert.True(t, ok, "leaf %d of %d, arity %d", i, n, cfg.Arity)
+
+					ok, err = v.Verify(input[i], proof)
+					require.NoError(t, err)
+					assert.True(t, ok)
+
+					ok, err = Verify(input[(i+1)%n], tree.Root, proof, nil)
+					require.NoError(t, err)
+					assert.False(t, ok)
+				}
+			}
+		}
+	})
+
+	t.Run("16-ary proofs are shallower", func(t *testing.T) {
+		input := generateRandomInputs(t, 4096)
+		binary, err := New(nil, input)
+		require.NoError(t, err)
+		wide, err := New(&Config{Arity: 16}, input)
+		require.NoError(t, err)
+		assert.Equal(t, 12, binary.Depth)
+		assert.Equal(t, 3, wide.Depth)
+	})
+
+	t.Run("arity mismatches are reported", func(t *testing.T) {
+		input := generateRandomInputs(t, 9)
+		tree, err := New(&Config{Arity: 3}, input)
+		require.NoError(t, err)
+		proof, err := tree.Proof(4)
+		require.NoError(t, err)
+
+		_, err = Verify(input[4], tree.Root, proof, &Config{})
+		var mismatch *ConfigMismatchError
+		require.ErrorAs(t, err, &mismatch)
+		assert.Equal(t, &ConfigMismatchError{Field: "Arity", Proof: 3, Config: 2}, mismatch)
+
+		res, err := VerifyDetailed(input[4], tree.Root, &Proof{Index: 4, Siblings: proof.Siblings[:3], Arity: 3}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, VerifyDepthMismatch, res.Reason)
+	})
+
+	t.Run("updates, appends and files", func(t *testing.T) {
+		cfg := &Config{Arity: 4, DomainSeperation: true}
+		input := generateRandomInputs(t, 6)
+		tree, err := New(cfg, input)
+		require.NoError(t, err)
+
+		for _, data := range generateRandomInputs(t, 14) {
+			require.NoError(t, tree.Append(data))
+			input = append(input, data)
+		}
+		input[3] = []byte("updated")
+		require.NoError(t, tree.Update(3, input[3]))
+
+		want, err := New(cfg, input)
+		require.NoError(t, err)
+		assert.Equal(t, want.Root, tree.Root)
+
+		path := filepath.Join(t.TempDir(), "tree.mxxh")
+		root, err := BuildFile(context.Background(), path, cfg, input)
+		require.NoError(t, err)
+		assert.Equal(t, want.Root, root)
+
+		ft, err := OpenFile(path)
+		require.NoError(t, err)
+		defer ft.Close()
+		assert.Equal(t, 4, ft.Arity)
+		for i := range input {
+			fromFile, err := ft.Proof(i)
+			require.NoError(t, err)
+			fromTree, err := tree.Proof(i)
+			require.NoError(t, err)
+			assert.Equal(t, fromTree, fromFile)
+		}
+	})
+}
+
+func TestProofFromLeaves(t *testing.T) {
+	t.Parallel()
+
+	t.Run("matches the tree's proofs", func(t *testing.T) {
+		for _, cfg := range []*Config{
+			{},
+			{XXH128: true, DomainSeperation: true, SealRoot: true},
+			{Seed: 3, Secret: []byte("key")},
+			{Arity: 3},
+			{Arity: 16, DomainSeperation: true},
+		} {
+			for _, n := range []int{2, 3, 9, 17, 64, 100} {
+				tree, err := New(cfg, generateRandomInputs(t, n))
+				require.NoError(t, err)
+
+				for i := 0; i < n; i++ {
+					want, err := tree.Proof(i)
+					require.NoError(t, err)
+					got, err := ProofFromLeaves(tree.Leaves, i, cfg)
+					require.NoError(t, err)
+					assert.Equal(t, want, got, "leaf %d of %d, arity %d", i, n, cfg.Arity)
+				}
+			}
+		}
+	})
+
+	t.Run("rejects bad arguments", func(t *testing.T) {
+		tree, err := New(nil, generateRandomInputs(t, 4))
+		require.NoError(t, err)
+
+		_, err = ProofFromLeaves(tree.Leaves[:1], 0, nil)
+		assert.ErrorIs(t, err, ErrInvalidNumOfLeaves)
+		_, err = ProofFromLeaves(tree.Leaves, 4, nil)
+		assert.ErrorIs(t, err, ErrProofInvalidIndex)
+		_, err = ProofFromLeaves(tree.Leaves, 0, &Config{XXH128: true})
+		assert.ErrorIs(t, err, ErrHashSize)
+		_, err = ProofFromLeaves(tree.Leaves, 0, &Config{Arity: 1})
+		assert.ErrorIs(t, err, ErrInvalidArity)
+	})
 }
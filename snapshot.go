@@ -0,0 +1,159 @@
+package merkletree
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Snapshot is an immutable version of a MerkleTree. It shares unchanged
+// storage pages with the tree and with other snapshots, so keeping many
+// versions costs only the pages their updates touched. A Snapshot is safe
+// for concurrent use.
+type Snapshot struct {
+	// frozen tree; never mutated after the snapshot is taken
+	tree     *MerkleTree
+	versions *versionIndex
+}
+
+// versionIndex records the snapshots derived from one tree by their root.
+type versionIndex struct {
+	mu     sync.RWMutex
+	byRoot map[string]*Snapshot
+}
+
+func (v *versionIndex) add(s *Snapshot) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.byRoot[string(s.tree.Root)] = s
+}
+
+// Snapshot returns the current version of the tree. Later calls to Update and
+// Append leave the snapshot's Root and proofs untouched. The snapshot is
+// recorded so that it can be found again with Version.
+func (m *MerkleTree) Snapshot() *Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.versions == nil {
+		m.versions = &versionIndex{byRoot: make(map[string]*Snapshot)}
+	}
+	s := &Snapshot{tree: m.freeze(), versions: m.versions}
+	m.versions.add(s)
+	return s
+}
+
+// Version looks up a snapshot of this tree, or one derived from it, by root.
+func (m *MerkleTree) Version(root []byte) (*Snapshot, bool) {
+	m.mu.RLock()
+	versions := m.versions
+	m.mu.RUnlock()
+
+	if versions == nil {
+		return nil, false
+	}
+	versions.mu.RLock()
+	defer versions.mu.RUnlock()
+	s, ok := versions.byRoot[string(root)]
+	return s, ok
+}
+
+// Release forgets the snapshot with the given root so that its pages can be
+// reclaimed once no longer referenced.
+func (m *MerkleTree) Release(root []byte) {
+	m.mu.RLock()
+	versions := m.versions
+	m.mu.RUnlock()
+
+	if versions == nil {
+		return
+	}
+	versions.mu.Lock()
+	defer versions.mu.Unlock()
+	delete(versions.byRoot, string(root))
+}
+
+// freeze returns a read-only copy of the tree sharing all of its levels. The
+// copy carries no leaf map, so it can only serve proofs by index.
+func (m *MerkleTree) freeze() *MerkleTree {
+	frozen := &MerkleTree{
+		Config:    m.Config,
+		hashFunc:  m.hashFunc,
+		native:    m.native,
+		nodes:     make([]*level, len(m.nodes)),
+		Root:      m.Root,
+		Depth:     m.Depth,
+		LeafCount: m.LeafCount,
+	}
+	for i, l := range m.nodes {
+		if l != nil {
+			frozen.nodes[i] = l.freeze()
+		}
+	}
+	return frozen
+}
+
+// thaw returns a writable copy of a frozen tree whose pages stay shared until written.
+func (m *MerkleTree) thaw() *MerkleTree {
+	thawed := &MerkleTree{
+		Config:    m.Config,
+		hashFunc:  m.hashFunc,
+		native:    m.native,
+		nodes:     make([]*level, len(m.nodes)),
+		Root:      m.Root,
+		Depth:     m.Depth,
+		LeafCount: m.LeafCount,
+	}
+	for i, l := range m.nodes {
+		if l != nil {
+			thawed.nodes[i] = l.thaw()
+		}
+	}
+	return thawed
+}
+
+// Root returns a copy of the snapshot's root.
+func (s *Snapshot) Root() Root {
+	return bytes.Clone(s.tree.Root)
+}
+
+// LeafCount returns the number of leaves in the snapshot.
+func (s *Snapshot) LeafCount() int {
+	return s.tree.LeafCount
+}
+
+// Depth returns the depth of the snapshot's tree.
+func (s *Snapshot) Depth() int {
+	return s.tree.Depth
+}
+
+// Proof generates the Merkle proof for the leaf at index against the snapshot's root.
+func (s *Snapshot) Proof(index int) (*Proof, error) {
+	return s.tree.proof(index)
+}
+
+// Update returns a new version with the input of the leaf at index replaced.
+// The receiver is unchanged.
+func (s *Snapshot) Update(index int, input []byte) (*Snapshot, error) {
+	t := s.tree.thaw()
+	if err := t.update(index, input); err != nil {
+		return nil, err
+	}
+	return s.derive(t), nil
+}
+
+// Append returns a new version with a leaf for input added at the end. The
+// receiver is unchanged.
+func (s *Snapshot) Append(input []byte) (*Snapshot, error) {
+	t := s.tree.thaw()
+	if err := t.append(input); err != nil {
+		return nil, err
+	}
+	return s.derive(t), nil
+}
+
+// derive freezes a tree modified from s into a new recorded version.
+func (s *Snapshot) derive(t *MerkleTree) *Snapshot {
+	next := &Snapshot{tree: t.freeze(), versions: s.versions}
+	s.versions.add(next)
+	return next
+}
@@ -0,0 +1,164 @@
+package merkletree
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	t.Parallel()
+
+	t.Run("older versions keep their root and proofs", func(t *testing.T) {
+		input := generateRandomInputs(t, 600)
+		tree, err := New(&Config{DomainSeperation: true}, input)
+		require.NoError(t, err)
+
+		v1 := tree.Snapshot()
+		root1 := v1.Root()
+
+		require.NoError(t, tree.Update(3, []byte("updated")))
+		require.NoError(t, tree.Append([]byte("appended")))
+		v2 := tree.Snapshot()
+
+		assert.Equal(t, root1, v1.Root(), "snapshot root changed")
+		assert.NotEqual(t, root1, v2.Root())
+		assert.Equal(t, 600, v1.LeafCount())
+		assert.Equal(t, 601, v2.LeafCount())
+
+		for _, i := range []int{0, 3, 255, 256, 599} {
+			proof, err := v1.Proof(i)
+			require.NoError(t, err)
+			ok, err := Verify(input[i], root1, proof, tree.Config)
+			require.NoError(t, err)
+			assert.True(t, ok, "old proof for leaf %d no longer verifies", i)
+		}
+
+		proof, err := v2.Proof(3)
+		require.NoError(t, err)
+		ok, err := Verify([]byte("updated"), v2.Root(), proof, tree.Config)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		// The tree's own view reflects the updates.
+		rebuilt := append(append([][]byte(nil), input...), []byte("appended"))
+		rebuilt[3] = []byte("updated")
+		want, err := New(&Config{DomainSeperation: true}, rebuilt)
+		require.NoError(t, err)
+		assert.Equal(t, want.Root, tree.CurrentRoot())
+		assert.Equal(t, want.Leaves, tree.Leaves)
+	})
+
+	t.Run("updates share untouched pages", func(t *testing.T) {
+		tree, err := New(nil, generateRandomInputs(t, 4*pageNodes))
+		require.NoError(t, err)
+
+		before := tree.Snapshot()
+		require.NoError(t, tree.Update(0, []byte("x")))
+		after := tree.Snapshot()
+
+		leaves0, leaves1 := before.tree.nodes[0], after.tree.nodes[0]
+		require.Len(t, leaves1.pages, 4)
+		assert.NotSame(t, &leaves0.pages[0][0], &leaves1.pages[0][0], "touched page should be copied")
+		for p := 1; p < 4; p++ {
+			assert.Same(t, &leaves0.pages[p][0], &leaves1.pages[p][0], "page %d should be shared", p)
+		}
+	})
+
+	t.Run("snapshot updates are persistent", func(t *testing.T) {
+		input := generateRandomInputs(t, 5)
+		tree, err := New(nil, input)
+		require.NoError(t, err)
+
+		base := tree.Snapshot()
+		updated, err := base.Update(4, []byte("four"))
+		require.NoError(t, err)
+		appended, err := updated.Append([]byte("five"))
+		require.NoError(t, err)
+
+		assert.Equal(t, tree.Root, base.Root(), "base snapshot changed")
+		assert.Equal(t, tree.Root, tree.CurrentRoot(), "tree changed by snapshot update")
+
+		want := append(append([][]byte(nil), input[:4]...), []byte("four"), []byte("five"))
+		wantTree, err := New(nil, want)
+		require.NoError(t, err)
+		assert.Equal(t, wantTree.Root, appended.Root())
+
+		wantUpdated, err := New(nil, want[:5])
+		require.NoError(t, err)
+		assert.Equal(t, wantUpdated.Root, updated.Root())
+
+		_, err = base.Update(5, []byte("x"))
+		assert.ErrorIs(t, err, ErrProofInvalidIndex)
+	})
+
+	t.Run("versions can be looked up by root", func(t *testing.T) {
+		tree, err := New(nil, generateRandomInputs(t, 4))
+		require.NoError(t, err)
+
+		_, ok := tree.Version(tree.Root)
+		assert.False(t, ok, "nothing recorded before the first snapshot")
+
+		v1 := tree.Snapshot()
+		v2, err := v1.Append([]byte("next"))
+		require.NoError(t, err)
+
+		got, ok := tree.Version(v1.Root())
+		assert.True(t, ok)
+		assert.Same(t, v1, got)
+
+		got, ok = tree.Version(v2.Root())
+		assert.True(t, ok, "derived snapshots are recorded too")
+		assert.Same(t, v2, got)
+
+		tree.Release(v1.Root())
+		_, ok = tree.Version(v1.Root())
+		assert.False(t, ok)
+	})
+}
+
+// Run with -race to check that snapshots can be read while the tree is mutated.
+func TestSnapshotConcurrentUse(t *testing.T) {
+	input := generateRandomInputs(t, 300)
+	tree, err := New(nil, input)
+	require.NoError(t, err)
+
+	snap := tree.Snapshot()
+	root := snap.Root()
+
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for i := r; i < len(input); i += 4 {
+				proof, err := snap.Proof(i)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if ok, err := Verify(input[i], root, proof, nil); err != nil || !ok {
+					t.Errorf("snapshot proof for leaf %d failed: %v", i, err)
+					return
+				}
+			}
+		}(r)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			if err := tree.Update(i, []byte{byte(i)}); err != nil {
+				t.Error(err)
+				return
+			}
+			if i%10 == 0 {
+				tree.Snapshot()
+			}
+		}
+	}()
+	wg.Wait()
+}
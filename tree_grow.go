@@ -1,59 +1,201 @@
 package merkletree
 
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Number of hashes computed between checks for cancellation.
+const ctxCheckInterval = 1024
+
 // builds the Merkle tree
-func (m *MerkleTree) grow() (err error) {
-	m.nodes = make([][][]byte, m.Depth)
-	m.nodes[0] = make([][]byte, m.LeafCount)
-	copy(m.nodes[0], m.Leaves)
+func (m *MerkleTree) grow(ctx context.Context) (err error) {
+	width, k := m.hashSize(), m.arity()
+	m.nodes = make([]*level, m.Depth)
+
+	// Each level is one contiguous buffer with room for its padding, so that
+	// the leaves keep aliasing level 0 once it is padded.
+	level := make([]byte, 0, paddedLevelCount(m.LeafCount, 0, k)*width)
+	for i, leaf := range m.Leaves {
+		if len(leaf) != width {
+			return fmt.Errorf("%w: leaf %d has %d bytes, want %d", ErrHashSize, i, len(leaf), width)
+		}
+		level = append(level, leaf...)
+		m.Leaves[i] = level[i*width : (i+1)*width : (i+1)*width]
+	}
+
+	native := m.native && k == 2
 
+	var raw []byte
 	for i := 0; i < m.Depth-1; i++ {
-		m.nodes[i] = appendNodeIfOdd(m.nodes[i])
-		nodeCount := len(m.nodes[i])
-		m.nodes[i+1] = make([][]byte, nodeCount>>1)
-
-		for j := 0; j < nodeCount; j += 2 {
-			raw := concatBytes(m.nodes[i][j], m.nodes[i][j+1])
-			if m.DomainSeperation {
-				raw = concatBytes([]byte{nodePrefix}, raw)
+		level = appendPadding(level, width, k)
+		m.storeLevel(i, level)
+		nodeCount := len(level) / width
+		next := make([]byte, 0, paddedLevelCount(m.LeafCount, i+1, k)*width)
+
+		for j := 0; j < nodeCount; j += k {
+			if (j/k)%ctxCheckInterval == 0 {
+				if err := checkContext(ctx); err != nil {
+					return err
+				}
+				m.reportProgress(StageGrow, i+1, j/k, nodeCount/k)
 			}
 
-			if m.nodes[i+1][j>>1], err = m.hashFunc(raw); err != nil {
+			if next, raw, err = m.appendParent(next, raw, level[j*width:(j+k)*width], native); err != nil {
 				return err
 			}
 		}
+		m.reportProgress(StageGrow, i+1, nodeCount/k, nodeCount/k)
+		level = next
 	}
+	level = appendPadding(level, width, k)
+	m.storeLevel(m.Depth-1, level)
 
-	// Final root computation — apply domain separation here too for consistency
-	rootInput := concatBytes(m.nodes[m.Depth-1][0], m.nodes[m.Depth-1][1])
-	if m.DomainSeperation {
-		rootInput = concatBytes([]byte{nodePrefix}, rootInput)
-	}
-
-	if m.Root, err = m.hashFunc(rootInput); err != nil {
+	if m.Root, err = m.hashRoot(level); err != nil {
 		return err
 	}
+	m.reportProgress(StageGrow, m.Depth, 1, 1)
 
 	return err
 }
 
+// storeLevel keeps a level's nodes unless the configured LevelInterval drops it.
+func (m *MerkleTree) storeLevel(level int, nodes []byte) {
+	if m.storesLevel(level) {
+		m.nodes[level] = newLevel(nodes, m.hashSize())
+	}
+}
+
+// storesLevel reports whether the configured LevelInterval keeps a level.
+func (m *MerkleTree) storesLevel(level int) bool {
+	return m.LevelInterval <= 1 || level%m.LevelInterval == 0
+}
+
+// appendParent appends the parent of the concatenated children to dst. raw
+// holds the hash input and is returned for reuse. native selects the
+// allocation-free path, which only hashes binary nodes.
+func (m *MerkleTree) appendParent(dst, raw, children []byte, native bool) ([]byte, []byte, error) {
+	if native {
+		width := len(children) / 2
+		return m.appendNativeNode(dst, children[:width], children[width:]), raw, nil
+	}
+	raw = appendChildrenInput(raw, children, m.DomainSeperation)
+	dst, err := m.hashFunc(dst, raw)
+	return dst, raw, err
+}
+
+// hashRoot hashes the concatenated nodes of the top level into the root.
+func (m *MerkleTree) hashRoot(children []byte) ([]byte, error) {
+	// Final root computation — apply domain separation here too for consistency
+	rootInput := appendChildrenInput(nil, children, m.DomainSeperation)
+	if m.SealRoot {
+		rootInput = append(rootInput, treeMetadata(m.LeafCount, m.Config)...)
+	}
+	return m.hashFunc(nil, rootInput)
+}
+
+// hashNode hashes the concatenated children of a node into their parent.
+func (m *MerkleTree) hashNode(children []byte) ([]byte, error) {
+	return m.hashFunc(nil, appendChildrenInput(nil, children, m.DomainSeperation))
+}
+
+// children returns the concatenated children of the node at level and index,
+// reading them through nodeAt.
+func (m *MerkleTree) children(level, index int) ([]byte, error) {
+	k := m.arity()
+	children := make([]byte, 0, k*m.hashSize())
+	for c := 0; c < k; c++ {
+		child, err := m.nodeAt(level-1, k*index+c)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child...)
+	}
+	return children, nil
+}
+
 // computes the leaf nodes from the input data
-func (m *MerkleTree) computeLeafNodes(input [][]byte) ([][]byte, error) {
+func (m *MerkleTree) computeLeafNodes(ctx context.Context, input [][]byte) ([][]byte, error) {
 	var (
 		leaves = make([][]byte, m.LeafCount)
+		buf    = make([]byte, 0, m.LeafCount*m.hashSize())
 		err    error
 	)
 
+	var native *nativeLeafHasher
+	if m.native {
+		native = m.newNativeLeafHasher()
+	}
+
 	for i := 0; i < m.LeafCount; i++ {
-		if leaves[i], err = sproutLeaf(input[i], m.hashFunc, m.DomainSeperation); err != nil {
+		if i%ctxCheckInterval == 0 {
+			if err := checkContext(ctx); err != nil {
+				return nil, err
+			}
+			m.reportProgress(StageLeaves, 0, i, m.LeafCount)
+		}
+		start := len(buf)
+		if buf, err = m.appendLeaf(buf, input[i], native); err != nil {
 			return nil, err
 		}
-		m.leafMap[string(leaves[i])] = i
+		leaves[i] = buf[start:len(buf):len(buf)]
+		if m.leafMap != nil {
+			m.addLeafIndex(leaves[i], i)
+		}
 	}
+	m.reportProgress(StageLeaves, 0, m.LeafCount, m.LeafCount)
 
 	return leaves, nil
 }
 
-func sproutLeaf(data []byte, hashFunc TypeHashFunc, domainSeparation bool) ([]byte, error) {
+// appendLeaf appends the leaf hash of data to dst, through the native hasher
+// when one is given.
+func (m *MerkleTree) appendLeaf(dst, data []byte, native *nativeLeafHasher) ([]byte, error) {
+	if native != nil {
+		return native.appendLeaf(dst, data), nil
+	}
+	return sproutLeaf(dst, data, m.hashFunc, m.DomainSeperation)
+}
+
+// reportProgress forwards construction progress to the configured callback, if any.
+func (m *MerkleTree) reportProgress(stage ProgressStage, level, done, total int) {
+	if m.Progress != nil {
+		m.Progress(stage, level, done, total)
+	}
+}
+
+// checkContext returns the context's error once it is done.
+func checkContext(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		return nil
+	}
+}
+
+// treeMetadata encodes the tree shape that a sealed root commits to. The
+// arity is only encoded for non-binary trees.
+func treeMetadata(leafCount int, config *Config) []byte {
+	meta := make([]byte, 10, 11)
+	binary.LittleEndian.PutUint64(meta, uint64(leafCount))
+	meta[8] = 8
+	if config.XXH128 {
+		meta[8] = 16
+	}
+	if config.DomainSeperation {
+		meta[9] = 1
+	}
+	if k := config.arity(); k != 2 {
+		meta = append(meta, byte(k))
+	}
+	return meta
+}
+
+// sproutLeaf appends the leaf hash of data to dst.
+func sproutLeaf(dst, data []byte, hashFunc appendHashFunc, domainSeparation bool) ([]byte, error) {
 	input := data
 	if domainSeparation {
 		input = make([]byte, 1+len(data))
@@ -61,12 +203,46 @@ func sproutLeaf(data []byte, hashFunc TypeHashFunc, domainSeparation bool) ([]by
 		copy(input[1:], data)
 	}
 
-	return hashFunc(input)
+	return hashFunc(dst, input)
+}
+
+// maxLeafCount bounds the leaf counts accepted from proofs and tree files. It
+// is far beyond any tree that fits in memory or on disk, and keeps the level
+// arithmetic below from overflowing. On 32-bit platforms it is math.MaxInt.
+const maxLeafCount = min(1<<56, math.MaxInt)
+
+// treeDepth returns the number of levels below the root of a tree with the
+// given leaf count and arity.
+func treeDepth(leafCount, arity int) int {
+	depth := 0
+	for count := leafCount; count > 1; count = (count-1)/arity + 1 {
+		depth++
+	}
+	return depth
+}
+
+// levelCount returns the number of nodes at a level before padding.
+func levelCount(leafCount, level, arity int) int {
+	count := leafCount
+	for ; level > 0 && count > 1; level-- {
+		count = (count-1)/arity + 1
+	}
+	return count
+}
+
+// paddedLevelCount returns the number of nodes stored for a level, including
+// the copies of the last node that fill its final group of arity siblings.
+// The top level of a binary tree always holds exactly two nodes.
+func paddedLevelCount(leafCount, level, arity int) int {
+	count := levelCount(leafCount, level, arity)
+	return ((count-1)/arity + 1) * arity
 }
 
-func appendNodeIfOdd(input [][]byte) [][]byte {
-	if len(input)%2 == 0 {
-		return input
+// appendPadding repeats the last node of a level until its node count is a
+// multiple of arity; for a binary tree it duplicates the odd node out.
+func appendPadding(level []byte, width, arity int) []byte {
+	for (len(level)/width)%arity != 0 {
+		level = append(level, level[len(level)-width:]...)
 	}
-	return append(input, input[len(input)-1])
+	return level
 }
@@ -0,0 +1,85 @@
+package merkletree
+
+import (
+	"encoding/binary"
+
+	"github.com/zeebo/xxh3"
+)
+
+// Largest internal node input: prefix byte and two 128-bit children.
+const maxNodeInput = 1 + 2*16
+
+// appendNativeNode hashes a pair of children into dst without allocating. The
+// prefix byte and both children are assembled in a stack buffer and the parent
+// is kept as a uint64 or xxh3.Uint128 until it is encoded into dst, which must
+// have spare capacity for it. The result is byte-identical to hashNode
+// over left and right.
+func (m *MerkleTree) appendNativeNode(dst, left, right []byte) []byte {
+	var buf [maxNodeInput]byte
+
+	n := 0
+	if m.DomainSeperation {
+		buf[0] = nodePrefix
+		n = 1
+	}
+	n += copy(buf[n:], left)
+	n += copy(buf[n:], right)
+
+	if m.XXH128 {
+		h := xxh3.Hash128Seed(buf[:n], m.Seed)
+		dst = binary.BigEndian.AppendUint64(dst, h.Hi)
+		return binary.BigEndian.AppendUint64(dst, h.Lo)
+	}
+	return binary.LittleEndian.AppendUint64(dst, xxh3.HashSeed(buf[:n], m.Seed))
+}
+
+// nativeLeafHasher hashes leaves without copying their data to prepend the
+// domain prefix; the prefix and data are streamed into a reused xxh3 state.
+type nativeLeafHasher struct {
+	*MerkleTree
+	h64  *xxh3.Hasher
+	h128 *xxh3.Hasher128
+}
+
+func (m *MerkleTree) newNativeLeafHasher() *nativeLeafHasher {
+	l := &nativeLeafHasher{MerkleTree: m}
+	if !m.DomainSeperation {
+		return l
+	}
+	if m.XXH128 {
+		l.h128 = xxh3.NewSeed128(m.Seed)
+	} else {
+		l.h64 = xxh3.NewSeed(m.Seed)
+	}
+	return l
+}
+
+// appendLeaf appends the leaf hash of data to dst. The result is byte-identical to sproutLeaf.
+func (l *nativeLeafHasher) appendLeaf(dst, data []byte) []byte {
+	prefix := [1]byte{leafPrefix}
+
+	if l.XXH128 {
+		var h xxh3.Uint128
+		if l.h128 != nil {
+			l.h128.ResetSeed(l.Seed)
+			_, _ = l.h128.Write(prefix[:])
+			_, _ = l.h128.Write(data)
+			h = l.h128.Sum128()
+		} else {
+			h = xxh3.Hash128Seed(data, l.Seed)
+		}
+		dst = binary.BigEndian.AppendUint64(dst, h.Hi)
+		return binary.BigEndian.AppendUint64(dst, h.Lo)
+	}
+
+	var h uint64
+	if l.h64 != nil {
+		l.h64.ResetSeed(l.Seed)
+		_, _ = l.h64.Write(prefix[:])
+		_, _ = l.h64.Write(data)
+		h = l.h64.Sum64()
+	} else {
+		h = xxh3.HashSeed(data, l.Seed)
+	}
+	return binary.LittleEndian.AppendUint64(dst, h)
+}
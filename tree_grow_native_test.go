@@ -0,0 +1,142 @@
+package merkletree
+
+import (
+	"context"
+	"fmt"
+	"math/bits"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildTree builds a tree the way New does, choosing the hashing path explicitly.
+func buildTree(tb testing.TB, config *Config, input [][]byte, native bool) *MerkleTree {
+	tb.Helper()
+
+	m := &MerkleTree{
+		Config:    config,
+		LeafCount: len(input),
+		Depth:     bits.Len(uint(len(input) - 1)),
+		hashFunc:  newHashFunc(config),
+		native:    native,
+		leafMap:   make(map[string]int),
+	}
+
+	var err error
+	m.Leaves, err = m.computeLeafNodes(context.Background(), input)
+	require.NoError(tb, err)
+	require.NoError(tb, m.grow(context.Background()))
+	return m
+}
+
+func TestGrowNative_MatchesGeneric(t *testing.T) {
+	t.Parallel()
+
+	configs := []Config{
+		{},
+		{DomainSeperation: true},
+		{XXH128: true},
+		{XXH128: true, DomainSeperation: true},
+		{DomainSeperation: true, Seed: 99},
+		{XXH128: true, DomainSeperation: true, Seed: 99, SealRoot: true},
+	}
+
+	for _, n := range []int{2, 3, 5, 16, 33} {
+		input := generateRandomInputs(t, n)
+		for _, cfg := range configs {
+			cfg := cfg
+			native := buildTree(t, &cfg, input, true)
+			generic := buildTree(t, &cfg, input, false)
+
+			assert.Equal(t, generic.Root, native.Root, "root mismatch for %d leaves, config %+v", n, cfg)
+			assert.Equal(t, generic.Leaves, native.Leaves, "leaf mismatch for %d leaves, config %+v", n, cfg)
+			assert.Equal(t, generic.nodes, native.nodes, "level mismatch for %d leaves, config %+v", n, cfg)
+		}
+	}
+}
+
+func TestGrowNative_ZeroAllocations(t *testing.T) {
+	for _, cfg := range []Config{{DomainSeperation: true}, {XXH128: true, DomainSeperation: true}} {
+		cfg := cfg
+		m := &MerkleTree{Config: &cfg}
+		width := m.hashSize()
+		left, right := make([]byte, width), make([]byte, width)
+		dst := make([]byte, 0, width)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			dst = m.appendNativeNode(dst[:0], left, right)
+		})
+		assert.Zero(t, allocs, "node hashing should not allocate (XXH128=%v)", cfg.XXH128)
+
+		leaves := m.newNativeLeafHasher()
+		data := make([]byte, 64)
+		allocs = testing.AllocsPerRun(100, func() {
+			dst = leaves.appendLeaf(dst[:0], data)
+		})
+		assert.Zero(t, allocs, "leaf hashing should not allocate (XXH128=%v)", cfg.XXH128)
+	}
+}
+
+func TestKeyedHash(t *testing.T) {
+	for _, cfg := range []Config{{Seed: 3, Secret: []byte("key")}, {XXH128: true, Seed: 3, Secret: []byte("key")}} {
+		hash := newHashFunc(&cfg)
+		data := make([]byte, 64)
+		dst, err := hash(nil, data)
+		require.NoError(t, err)
+
+		want, _ := appendXXH3Hash64Seed(nil, append([]byte("key"), data...), 3)
+		if cfg.XXH128 {
+			want, _ = appendXXH3Hash128Seed(nil, append([]byte("key"), data...), 3)
+		}
+		assert.Equal(t, want, dst, "the secret is prepended (XXH128=%v)", cfg.XXH128)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			dst, _ = hash(dst[:0], data)
+		})
+		assert.Zero(t, allocs, "keyed hashing should not allocate (XXH128=%v)", cfg.XXH128)
+	}
+}
+
+func BenchmarkGrow(b *testing.B) {
+	input := make([][]byte, 1<<16)
+	for i := range input {
+		input[i] = []byte{byte(i), byte(i >> 8), byte(i >> 16)}
+	}
+
+	for _, native := range []bool{false, true} {
+		for _, use128 := range []bool{false, true} {
+			cfg := &Config{DomainSeperation: true, XXH128: use128}
+			tree := buildTree(b, cfg, input, native)
+
+			b.Run(fmt.Sprintf("native=%v/xxh128=%v", native, use128), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if err := tree.grow(context.Background()); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkComputeLeafNodes(b *testing.B) {
+	input := make([][]byte, 1<<16)
+	for i := range input {
+		input[i] = []byte{byte(i), byte(i >> 8), byte(i >> 16)}
+	}
+
+	for _, native := range []bool{false, true} {
+		tree := buildTree(b, &Config{DomainSeperation: true}, input, native)
+
+		b.Run(fmt.Sprintf("native=%v", native), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := tree.computeLeafNodes(context.Background(), input); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
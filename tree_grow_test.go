@@ -2,7 +2,9 @@ package merkletree
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"math"
 	"math/bits"
 	"testing"
 
@@ -120,27 +122,27 @@ func TestGrow_HashErrorPropagation(t *testing.T) {
 		Config: &Config{
 			DomainSeperation: false,
 		},
-		hashFunc:  mockHash,
+		hashFunc:  appendHashFuncOf(mockHash),
 		LeafCount: len(input),
 		Depth:     bits.Len(uint(len(input) - 1)),
 		leafMap:   make(map[string]int),
 	}
 
 	// Leaves will fail
-	_, err := tree.computeLeafNodes(input)
+	_, err := tree.computeLeafNodes(context.Background(), input)
 	assert.ErrorIs(t, err, ErrHashFuncFailed)
 
 	// If we mock only internal hash (simulate leaf success)
-	tree.hashFunc = func(data []byte) ([]byte, error) {
+	tree.hashFunc = appendHashFuncOf(func(data []byte) ([]byte, error) {
 		// Pretend leaves succeeded earlier
 		if len(data) == 32 || (len(data) == 33 && data[0] == leafPrefix) {
 			return bytes.Repeat([]byte{0xAA}, 8), nil // fake hash
 		}
 		return nil, ErrHashFuncFailed
-	}
+	})
 
-	tree.Leaves, _ = tree.computeLeafNodes(input) // fake success
-	err = tree.grow()
+	tree.Leaves, _ = tree.computeLeafNodes(context.Background(), input) // fake success
+	err = tree.grow(context.Background())
 	assert.ErrorIs(t, err, ErrHashFuncFailed, "grow should propagate internal hash error")
 }
 
@@ -165,10 +167,221 @@ func TestGrow_OddCountDuplication(t *testing.T) {
 	require.NoError(t, err)
 
 	// After grow, level 0 should have 4 elements, last two equal
-	assert.Len(t, tree.nodes[0], 4)
-	assert.True(t, bytes.Equal(tree.nodes[0][2], tree.nodes[0][3]),
+	assert.Equal(t, 4, tree.nodes[0].count)
+	third, err := tree.nodeAt(0, 2)
+	require.NoError(t, err)
+	fourth, err := tree.nodeAt(0, 3)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(third, fourth),
 		"last leaf should be duplicated for odd count")
 
 	// Root should be computable without panic
 	assert.NotEmpty(t, tree.Root)
 }
+
+func TestGrow_SealedRoot(t *testing.T) {
+	input := generateRandomInputs(t, 5)
+
+	plain, err := New(&Config{DomainSeperation: true}, input)
+	require.NoError(t, err)
+
+	sealed, err := New(&Config{DomainSeperation: true, SealRoot: true}, input)
+	require.NoError(t, err)
+
+	assert.NotEqual(t, plain.Root, sealed.Root, "sealing should change the root")
+	assert.Equal(t, plain.Leaves, sealed.Leaves, "sealing should not affect leaves")
+
+	// 5 and 6 leaves share the padded level layout, so only the sealed roots tell them apart.
+	padded := append(input, input[4])
+	plainPadded, err := New(&Config{DomainSeperation: true}, padded)
+	require.NoError(t, err)
+	sealedPadded, err := New(&Config{DomainSeperation: true, SealRoot: true}, padded)
+	require.NoError(t, err)
+
+	assert.Equal(t, plain.Root, plainPadded.Root, "unsealed roots ignore the leaf count")
+	assert.NotEqual(t, sealed.Root, sealedPadded.Root, "sealed roots commit to the leaf count")
+}
+
+func TestGrow_ProgressReporting(t *testing.T) {
+	type event struct {
+		stage              ProgressStage
+		level, done, total int
+	}
+	var events []event
+
+	cfg := &Config{
+		Progress: func(stage ProgressStage, level, done, total int) {
+			events = append(events, event{stage, level, done, total})
+		},
+	}
+
+	input := generateRandomInputs(t, 5)
+	tree, err := New(cfg, input)
+	require.NoError(t, err)
+
+	assert.Equal(t, []event{
+		{StageLeaves, 0, 0, 5},
+		{StageLeaves, 0, 5, 5},
+		{StageGrow, 1, 0, 3},
+		{StageGrow, 1, 3, 3},
+		{StageGrow, 2, 0, 2},
+		{StageGrow, 2, 2, 2},
+		{StageGrow, 3, 1, 1},
+	}, events)
+	assert.Equal(t, 3, tree.Depth)
+}
+
+func TestGrow_FlatStorage(t *testing.T) {
+	input := generateRandomInputs(t, 2*pageNodes+5)
+
+	for _, cfg := range []*Config{{}, {XXH128: true}, {Arity: 16}} {
+		tree, err := New(cfg, input)
+		require.NoError(t, err)
+
+		width := tree.hashSize()
+		for level, nodes := range tree.nodes {
+			padded := paddedLevelCount(tree.LeafCount, level, tree.arity())
+			assert.Equal(t, padded, nodes.count, "level %d count", level)
+
+			// Every page but the last is full, and each is one contiguous buffer.
+			for p, page := range nodes.pages {
+				want := min(pageNodes, padded-p*pageNodes)
+				assert.Len(t, page, want*width, "level %d page %d", level, p)
+			}
+		}
+
+		// Leaves alias the first level instead of holding their own copies.
+		for i, leaf := range tree.Leaves {
+			assert.Len(t, leaf, width)
+			assert.Same(t, &tree.nodes[0].node(i)[0], &leaf[0], "leaf %d should alias level 0", i)
+		}
+	}
+}
+
+func TestGrow_RejectsUnexpectedHashSize(t *testing.T) {
+	input := generateRandomInputs(t, 4)
+
+	tree := &MerkleTree{
+		Config:    &Config{XXH128: true},
+		LeafCount: len(input),
+		Depth:     bits.Len(uint(len(input) - 1)),
+		leafMap:   make(map[string]int),
+		hashFunc:  appendXXH3Hash64, // 8 bytes where 16 are expected
+	}
+
+	var err error
+	tree.Leaves, err = tree.computeLeafNodes(context.Background(), input)
+	require.NoError(t, err)
+	assert.ErrorIs(t, tree.grow(context.Background()), ErrHashSize)
+}
+
+// referenceKaryRoot computes the root of a k-ary tree level by level, padding
+// every level with copies of its last node.
+func referenceKaryRoot(t *testing.T, cfg *Config, input [][]byte) []byte {
+	hashFunc := newHashFunc(cfg)
+	var level [][]byte
+	for _, data := range input {
+		leaf, err := sproutLeaf(nil, data, hashFunc, cfg.DomainSeperation)
+		require.NoError(t, err)
+		level = append(level, leaf)
+	}
+
+	for {
+		for len(level)%cfg.Arity != 0 {
+			level = append(level, level[len(level)-1])
+		}
+		var next [][]byte
+		for i := 0; i < len(level); i += cfg.Arity {
+			node := bytes.Join(level[i:i+cfg.Arity], nil)
+			if cfg.DomainSeperation {
+				node = append([]byte{nodePrefix}, node...)
+			}
+			if len(level) == cfg.Arity && cfg.SealRoot {
+				node = append(node, treeMetadata(len(input), cfg)...)
+			}
+			parent, err := hashFunc(nil, node)
+			require.NoError(t, err)
+			next = append(next, parent)
+		}
+		if len(next) == 1 {
+			return next[0]
+		}
+		level = next
+	}
+}
+
+func TestGrow_Arity(t *testing.T) {
+	t.Parallel()
+
+	t.Run("matches a reference k-ary tree", func(t *testing.T) {
+		for _, arity := range []int{3, 4, 16} {
+			for _, n := range []int{2, 3, 4, 5, 16, 17, 50} {
+				for _, cfg := range []*Config{
+					{Arity: arity},
+					{Arity: arity, DomainSeperation: true, SealRoot: true},
+				} {
+					input := generateRandomInputs(t, n)
+					tree, err := New(cfg, input)
+					require.NoError(t, err)
+					assert.Equal(t, treeDepth(n, arity), tree.Depth)
+					assert.Equal(t, referenceKaryRoot(t, cfg, input), []byte(tree.Root), "arity %d, %d leaves", arity, n)
+				}
+			}
+		}
+	})
+
+	t.Run("binary trees are unchanged", func(t *testing.T) {
+		input := generateRandomInputs(t, 9)
+		binary, err := New(&Config{DomainSeperation: true}, input)
+		require.NoError(t, err)
+		explicit, err := New(&Config{DomainSeperation: true, Arity: 2}, input)
+		require.NoError(t, err)
+		assert.Equal(t, binary.Root, explicit.Root)
+	})
+
+	t.Run("sealed roots commit to the arity", func(t *testing.T) {
+		input := generateRandomInputs(t, 4)
+		binary, err := New(&Config{SealRoot: true}, input)
+		require.NoError(t, err)
+		quaternary, err := New(&Config{SealRoot: true, Arity: 4}, input)
+		require.NoError(t, err)
+		assert.NotEqual(t, binary.Root, quaternary.Root)
+		assert.Len(t, treeMetadata(4, quaternary.Config), 11)
+	})
+
+	t.Run("rejects invalid arities", func(t *testing.T) {
+		for _, arity := range []int{-1, 1, 256} {
+			_, err := New(&Config{Arity: arity}, generateRandomInputs(t, 4))
+			assert.ErrorIs(t, err, ErrInvalidArity)
+		}
+	})
+}
+
+func TestTreeShape_LargeLeafCounts(t *testing.T) {
+	t.Parallel()
+
+	// 1<<62+1 and math.MaxInt on 64-bit platforms.
+	large := []int{math.MaxInt/2 + 2, math.MaxInt}
+	for _, n := range large {
+		assert.Equal(t, bits.UintSize-1, treeDepth(n, 2))
+		assert.Equal(t, bits.UintSize/2, treeDepth(n, 4))
+		assert.Equal(t, 1, levelCount(n, bits.UintSize-1, 2))
+		assert.Equal(t, 1, levelCount(n, 100, 16))
+	}
+	assert.Equal(t, math.MaxInt/4+2, levelCount(large[0], 1, 2))
+	assert.Equal(t, math.MaxInt/4+3, paddedLevelCount(large[0], 1, 2))
+
+	// Proofs claiming absurd leaf counts are rejected rather than hanging.
+	for _, n := range large {
+		proof := &Proof{LeafCount: n, Siblings: [][]byte{make([]byte, 8)}}
+		ok, err := Verify([]byte("x"), make([]byte, 8), proof, nil)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		ok, err = NewVerifier(make([]byte, 8), nil).Verify([]byte("x"), proof)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		assert.Nil(t, proof.Compact().Omitted)
+	}
+}
@@ -0,0 +1,594 @@
+package merkletree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Kinds of trie node, encoded after the domain prefix.
+const (
+	trieKindEmpty byte = iota
+	trieKindLeaf
+	trieKindExtension
+	trieKindBranch
+)
+
+// Trie is a hexary Merkle Patricia trie mapping string keys to values. Keys
+// are split into nibbles; runs of nibbles without branching are compressed
+// into extension and leaf nodes. Nodes are hashed with the configured xxh3
+// variant, seed and secret, and always carry the leaf and node domain
+// prefixes. Hashes are cached per node and recomputed only along the paths
+// changed since the last Root. A Trie is not safe for concurrent use.
+type Trie struct {
+	*Config
+	hashFunc appendHashFunc
+	root     trieNode
+	len      int
+	// nibbles is scratch space for key conversion.
+	nibbles []byte
+}
+
+type trieNode interface {
+	// cachedHash returns the node's hash, or nil if it changed since it was
+	// last hashed.
+	cachedHash() []byte
+	setHash([]byte)
+}
+
+type trieLeaf struct {
+	path  []byte
+	value []byte
+	hash  []byte
+}
+
+type trieExtension struct {
+	path  []byte
+	child trieNode
+	hash  []byte
+}
+
+type trieBranch struct {
+	children [16]trieNode
+	value    []byte
+	hasValue bool
+	hash     []byte
+}
+
+func (n *trieLeaf) cachedHash() []byte      { return n.hash }
+func (n *trieLeaf) setHash(h []byte)        { n.hash = h }
+func (n *trieExtension) cachedHash() []byte { return n.hash }
+func (n *trieExtension) setHash(h []byte)   { n.hash = h }
+func (n *trieBranch) cachedHash() []byte    { return n.hash }
+func (n *trieBranch) setHash(h []byte)      { n.hash = h }
+
+// TrieProof proves the value of a key, or its absence, in a trie. It holds
+// the encodings of the nodes on the key's path, root first.
+type TrieProof struct {
+	Nodes [][]byte
+}
+
+// NewTrie returns an empty trie. SealRoot and Arity do not apply to tries and
+// are rejected; DomainSeperation is implied.
+func NewTrie(config *Config) (*Trie, error) {
+	if config == nil {
+		config = new(Config)
+	}
+	if config.SealRoot {
+		return nil, fmt.Errorf("%w: SealRoot", ErrUnsupportedConfig)
+	}
+	if config.arity() != 2 {
+		return nil, fmt.Errorf("%w: Arity %d", ErrUnsupportedConfig, config.Arity)
+	}
+	return &Trie{Config: config, hashFunc: newHashFunc(config)}, nil
+}
+
+// Len returns the number of keys in the trie.
+func (t *Trie) Len() int {
+	return t.len
+}
+
+// Get returns a copy of the value stored for key.
+func (t *Trie) Get(key string) ([]byte, bool) {
+	path := t.keyNibbles(key)
+	n := t.root
+	for {
+		switch node := n.(type) {
+		case nil:
+			return nil, false
+		case *trieLeaf:
+			if !bytes.Equal(node.path, path) {
+				return nil, false
+			}
+			return bytes.Clone(node.value), true
+		case *trieExtension:
+			if !bytes.HasPrefix(path, node.path) {
+				return nil, false
+			}
+			path, n = path[len(node.path):], node.child
+		case *trieBranch:
+			if len(path) == 0 {
+				return bytes.Clone(node.value), node.hasValue
+			}
+			path, n = path[1:], node.children[path[0]]
+		}
+	}
+}
+
+// Put stores a copy of value for key, replacing any previous value.
+func (t *Trie) Put(key string, value []byte) {
+	var added bool
+	t.root, added = t.insert(t.root, t.keyNibbles(key), bytes.Clone(value))
+	if added {
+		t.len++
+	}
+}
+
+// Delete removes key and reports whether it was present.
+func (t *Trie) Delete(key string) bool {
+	root, deleted := t.delete(t.root, t.keyNibbles(key))
+	if deleted {
+		t.root = root
+		t.len--
+	}
+	return deleted
+}
+
+// Root returns the root hash of the trie, hashing the nodes changed since the
+// last call.
+func (t *Trie) Root() (Root, error) {
+	if t.root == nil {
+		return t.hashFunc(nil, []byte{nodePrefix, trieKindEmpty})
+	}
+	h, err := t.hash(t.root)
+	return bytes.Clone(h), err
+}
+
+// Prove returns a proof of the value stored for key, or of its absence.
+func (t *Trie) Prove(key string) (*TrieProof, error) {
+	proof := new(TrieProof)
+	if t.root == nil {
+		proof.Nodes = append(proof.Nodes, []byte{nodePrefix, trieKindEmpty})
+		return proof, nil
+	}
+
+	path := t.keyNibbles(key)
+	n := t.root
+	for n != nil {
+		enc, err := t.encode(nil, n)
+		if err != nil {
+			return nil, err
+		}
+		proof.Nodes = append(proof.Nodes, enc)
+
+		switch node := n.(type) {
+		case *trieLeaf:
+			n = nil
+		case *trieExtension:
+			if !bytes.HasPrefix(path, node.path) {
+				n = nil
+				break
+			}
+			path, n = path[len(node.path):], node.child
+		case *trieBranch:
+			if len(path) == 0 {
+				n = nil
+				break
+			}
+			path, n = path[1:], node.children[path[0]]
+		}
+	}
+	return proof, nil
+}
+
+// keyNibbles splits key into nibbles, high nibble first, reusing scratch space.
+func (t *Trie) keyNibbles(key string) []byte {
+	t.nibbles = appendNibbles(t.nibbles[:0], key)
+	return t.nibbles
+}
+
+func appendNibbles(dst []byte, key string) []byte {
+	for i := 0; i < len(key); i++ {
+		dst = append(dst, key[i]>>4, key[i]&0x0f)
+	}
+	return dst
+}
+
+// insert stores value at path below n and returns the replacement for n. It
+// reports whether the key is new.
+func (t *Trie) insert(n trieNode, path, value []byte) (trieNode, bool) {
+	switch node := n.(type) {
+	case nil:
+		return &trieLeaf{path: bytes.Clone(path), value: value}, true
+
+	case *trieLeaf:
+		common := commonPrefix(node.path, path)
+		if common == len(node.path) && common == len(path) {
+			node.value, node.hash = value, nil
+			return node, false
+		}
+		branch := new(trieBranch)
+		branch.put(node.path[common:], node.value)
+		branch.put(bytes.Clone(path[common:]), value)
+		return wrapExtension(path[:common], branch), true
+
+	case *trieExtension:
+		common := commonPrefix(node.path, path)
+		if common == len(node.path) {
+			child, added := t.insert(node.child, path[common:], value)
+			node.child, node.hash = child, nil
+			return node, added
+		}
+		branch := new(trieBranch)
+		branch.children[node.path[common]] = wrapExtension(node.path[common+1:], node.child)
+		branch.put(bytes.Clone(path[common:]), value)
+		return wrapExtension(path[:common], branch), true
+
+	case *trieBranch:
+		node.hash = nil
+		if len(path) == 0 {
+			added := !node.hasValue
+			node.value, node.hasValue = value, true
+			return node, added
+		}
+		child, added := t.insert(node.children[path[0]], path[1:], value)
+		node.children[path[0]] = child
+		return node, added
+	}
+	panic("merkletree: unknown trie node")
+}
+
+// put places a value below a fresh branch, at path relative to the branch.
+func (b *trieBranch) put(path, value []byte) {
+	if len(path) == 0 {
+		b.value, b.hasValue = value, true
+		return
+	}
+	b.children[path[0]] = &trieLeaf{path: path[1:], value: value}
+}
+
+// delete removes path below n and returns the replacement for n, which is
+// restored to canonical form.
+func (t *Trie) delete(n trieNode, path []byte) (trieNode, bool) {
+	switch node := n.(type) {
+	case *trieLeaf:
+		if !bytes.Equal(node.path, path) {
+			return n, false
+		}
+		return nil, true
+
+	case *trieExtension:
+		if !bytes.HasPrefix(path, node.path) {
+			return n, false
+		}
+		child, deleted := t.delete(node.child, path[len(node.path):])
+		if !deleted {
+			return n, false
+		}
+		return joinPath(node.path, child), true
+
+	case *trieBranch:
+		if len(path) == 0 {
+			if !node.hasValue {
+				return n, false
+			}
+			node.value, node.hasValue = nil, false
+		} else {
+			child, deleted := t.delete(node.children[path[0]], path[1:])
+			if !deleted {
+				return n, false
+			}
+			node.children[path[0]] = child
+		}
+		node.hash = nil
+		return node.collapse(), true
+	}
+	return n, false
+}
+
+// collapse replaces a branch left with a single entry by an equivalent leaf
+// or extension.
+func (b *trieBranch) collapse() trieNode {
+	only, count := -1, 0
+	for i, child := range b.children {
+		if child != nil {
+			only, count = i, count+1
+		}
+	}
+	switch {
+	case count == 0 && b.hasValue:
+		return &trieLeaf{path: []byte{}, value: b.value}
+	case count == 1 && !b.hasValue:
+		return joinPath([]byte{byte(only)}, b.children[only])
+	}
+	return b
+}
+
+// joinPath prefixes child with path, merging it into a leaf or extension child.
+func joinPath(path []byte, child trieNode) trieNode {
+	switch node := child.(type) {
+	case nil:
+		return nil
+	case *trieLeaf:
+		return &trieLeaf{path: concatBytes(path, node.path), value: node.value}
+	case *trieExtension:
+		return &trieExtension{path: concatBytes(path, node.path), child: node.child}
+	}
+	return &trieExtension{path: bytes.Clone(path), child: child}
+}
+
+// wrapExtension returns an extension over path leading to child, or child
+// itself for an empty path.
+func wrapExtension(path []byte, child trieNode) trieNode {
+	if len(path) == 0 {
+		return child
+	}
+	return &trieExtension{path: bytes.Clone(path), child: child}
+}
+
+func commonPrefix(a, b []byte) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+// hash returns the cached hash of n, hashing it and its changed descendants first.
+func (t *Trie) hash(n trieNode) ([]byte, error) {
+	if h := n.cachedHash(); h != nil {
+		return h, nil
+	}
+	enc, err := t.encode(nil, n)
+	if err != nil {
+		return nil, err
+	}
+	h, err := t.hashFunc(nil, enc)
+	if err != nil {
+		return nil, err
+	}
+	n.setHash(h)
+	return h, nil
+}
+
+// encode appends the hash input of n to dst:
+//
+//	leaf:      leafPrefix, kind, path, uvarint value length, value
+//	extension: nodePrefix, kind, path, child hash
+//	branch:    nodePrefix, kind, uint16 child bitmap, child hashes,
+//	           value flag, and if set uvarint value length, value
+//
+// Paths are encoded as a uvarint nibble count followed by packed nibbles.
+func (t *Trie) encode(dst []byte, n trieNode) ([]byte, error) {
+	switch node := n.(type) {
+	case *trieLeaf:
+		dst = append(dst, leafPrefix, trieKindLeaf)
+		dst = appendTriePath(dst, node.path)
+		dst = binary.AppendUvarint(dst, uint64(len(node.value)))
+		return append(dst, node.value...), nil
+
+	case *trieExtension:
+		dst = append(dst, nodePrefix, trieKindExtension)
+		dst = appendTriePath(dst, node.path)
+		h, err := t.hash(node.child)
+		if err != nil {
+			return nil, err
+		}
+		return append(dst, h...), nil
+
+	case *trieBranch:
+		dst = append(dst, nodePrefix, trieKindBranch)
+		var bitmap uint16
+		for i, child := range node.children {
+			if child != nil {
+				bitmap |= 1 << i
+			}
+		}
+		dst = binary.LittleEndian.AppendUint16(dst, bitmap)
+		for _, child := range node.children {
+			if child == nil {
+				continue
+			}
+			h, err := t.hash(child)
+			if err != nil {
+				return nil, err
+			}
+			dst = append(dst, h...)
+		}
+		if !node.hasValue {
+			return append(dst, 0), nil
+		}
+		dst = append(dst, 1)
+		dst = binary.AppendUvarint(dst, uint64(len(node.value)))
+		return append(dst, node.value...), nil
+	}
+	panic("merkletree: unknown trie node")
+}
+
+func appendTriePath(dst, nibbles []byte) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(nibbles)))
+	for i := 0; i < len(nibbles); i += 2 {
+		b := nibbles[i] << 4
+		if i+1 < len(nibbles) {
+			b |= nibbles[i+1]
+		}
+		dst = append(dst, b)
+	}
+	return dst
+}
+
+// decodedTrieNode is a trie node read back from its encoding.
+type decodedTrieNode struct {
+	kind     byte
+	path     []byte
+	value    []byte
+	hasValue bool
+	// child hashes; only children[0] is used by extensions
+	children [16][]byte
+}
+
+// decodeTrieNode parses a node encoding produced by encode.
+func decodeTrieNode(enc []byte, width int) (*decodedTrieNode, error) {
+	malformed := fmt.Errorf("%w: malformed trie node", ErrProofMismatch)
+	if len(enc) < 2 {
+		return nil, malformed
+	}
+	n := &decodedTrieNode{kind: enc[1]}
+	rest := enc[2:]
+
+	readPath := func() bool {
+		count, k := binary.Uvarint(rest)
+		if k <= 0 || count > uint64(2*len(rest)) || uint64(len(rest)-k) < (count+1)/2 {
+			return false
+		}
+		packed := rest[k : k+int((count+1)/2)]
+		for i := 0; i < int(count); i++ {
+			b := packed[i/2]
+			if i%2 == 0 {
+				b >>= 4
+			}
+			n.path = append(n.path, b&0x0f)
+		}
+		rest = rest[k+len(packed):]
+		return true
+	}
+	readValue := func() bool {
+		size, k := binary.Uvarint(rest)
+		if k <= 0 || uint64(len(rest)-k) < size {
+			return false
+		}
+		n.value, rest = rest[k:k+int(size)], rest[k+int(size):]
+		n.hasValue = true
+		return true
+	}
+	readHash := func() ([]byte, bool) {
+		if len(rest) < width {
+			return nil, false
+		}
+		h := rest[:width]
+		rest = rest[width:]
+		return h, true
+	}
+
+	switch {
+	case n.kind == trieKindEmpty && enc[0] == nodePrefix:
+	case n.kind == trieKindLeaf && enc[0] == leafPrefix:
+		if !readPath() || !readValue() {
+			return nil, malformed
+		}
+	case n.kind == trieKindExtension && enc[0] == nodePrefix:
+		var ok bool
+		if !readPath() || len(n.path) == 0 {
+			return nil, malformed
+		}
+		if n.children[0], ok = readHash(); !ok {
+			return nil, malformed
+		}
+	case n.kind == trieKindBranch && enc[0] == nodePrefix:
+		if len(rest) < 2 {
+			return nil, malformed
+		}
+		bitmap := binary.LittleEndian.Uint16(rest)
+		rest = rest[2:]
+		for i := range n.children {
+			if bitmap&(1<<i) == 0 {
+				continue
+			}
+			var ok bool
+			if n.children[i], ok = readHash(); !ok {
+				return nil, malformed
+			}
+		}
+		if len(rest) == 0 || rest[0] > 1 {
+			return nil, malformed
+		}
+		flag := rest[0]
+		rest = rest[1:]
+		if flag == 1 && !readValue() {
+			return nil, malformed
+		}
+	default:
+		return nil, malformed
+	}
+
+	if len(rest) != 0 {
+		return nil, malformed
+	}
+	return n, nil
+}
+
+// VerifyTrie checks a trie proof for key against root without access to the
+// trie. It returns the proven value and true, or false if the proof shows the
+// key is absent. A proof that does not match root or key fails with an error
+// matching ErrProofMismatch.
+func VerifyTrie(root []byte, key string, proof *TrieProof, config *Config) ([]byte, bool, error) {
+	if proof == nil {
+		return nil, false, ErrProofIsNil
+	}
+	if config == nil {
+		config = new(Config)
+	}
+	hashFunc := newHashFunc(config)
+	width := 8
+	if config.XXH128 {
+		width = 16
+	}
+
+	path := appendNibbles(nil, key)
+	want := root
+	for i, enc := range proof.Nodes {
+		h, err := hashFunc(nil, enc)
+		if err != nil {
+			return nil, false, err
+		}
+		if !bytes.Equal(h, want) {
+			return nil, false, fmt.Errorf("%w: node %d does not match its parent's hash", ErrProofMismatch, i)
+		}
+		node, err := decodeTrieNode(enc, width)
+		if err != nil {
+			return nil, false, err
+		}
+
+		// done is set when the node settles the lookup; want is set to the
+		// hash of the next node otherwise.
+		var (
+			value       []byte
+			found, done bool
+		)
+		switch node.kind {
+		case trieKindEmpty:
+			done = true
+		case trieKindLeaf:
+			done = true
+			if bytes.Equal(node.path, path) {
+				value, found = node.value, true
+			}
+		case trieKindExtension:
+			if !bytes.HasPrefix(path, node.path) {
+				done = true
+				break
+			}
+			path, want = path[len(node.path):], node.children[0]
+		case trieKindBranch:
+			if len(path) == 0 {
+				value, found, done = node.value, node.hasValue, true
+				break
+			}
+			if want = node.children[path[0]]; want == nil {
+				done = true
+				break
+			}
+			path = path[1:]
+		}
+
+		if done {
+			if i != len(proof.Nodes)-1 {
+				return nil, false, fmt.Errorf("%w: unexpected nodes after %d", ErrProofMismatch, i)
+			}
+			return value, found, nil
+		}
+	}
+	return nil, false, fmt.Errorf("%w: proof ends before the key is resolved", ErrProofMismatch)
+}
@@ -0,0 +1,200 @@
+package merkletree
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrie(t *testing.T) {
+	t.Parallel()
+
+	keys := []string{"", "a", "ab", "abc", "abd", "b", "config/timeout", "config/retries", "config/tls/cert", "zz"}
+
+	t.Run("put, get and delete", func(t *testing.T) {
+		trie, err := NewTrie(nil)
+		require.NoError(t, err)
+
+		for i, key := range keys {
+			trie.Put(key, []byte(fmt.Sprint("v", i)))
+		}
+		assert.Equal(t, len(keys), trie.Len())
+		for i, key := range keys {
+			value, ok := trie.Get(key)
+			require.True(t, ok, "key %q", key)
+			assert.Equal(t, []byte(fmt.Sprint("v", i)), value)
+		}
+		_, ok := trie.Get("config")
+		assert.False(t, ok)
+
+		trie.Put("ab", []byte("replaced"))
+		assert.Equal(t, len(keys), trie.Len())
+		value, _ := trie.Get("ab")
+		assert.Equal(t, []byte("replaced"), value)
+
+		assert.True(t, trie.Delete("ab"))
+		assert.False(t, trie.Delete("ab"))
+		assert.False(t, trie.Delete("config"))
+		_, ok = trie.Get("ab")
+		assert.False(t, ok)
+		value, ok = trie.Get("abc")
+		require.True(t, ok)
+		assert.Equal(t, []byte("v3"), value)
+		assert.Equal(t, len(keys)-1, trie.Len())
+	})
+
+	t.Run("root is independent of history", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(1))
+		want, err := NewTrie(nil)
+		require.NoError(t, err)
+		for _, key := range keys[:6] {
+			want.Put(key, []byte(key))
+		}
+		wantRoot, err := want.Root()
+		require.NoError(t, err)
+
+		for round := 0; round < 20; round++ {
+			trie, err := NewTrie(nil)
+			require.NoError(t, err)
+			for _, i := range rng.Perm(len(keys)) {
+				trie.Put(keys[i], []byte(keys[i]))
+				// Hash intermediate states so that stale caches would show.
+				_, err := trie.Root()
+				require.NoError(t, err)
+			}
+			for _, i := range rng.Perm(len(keys) - 6) {
+				require.True(t, trie.Delete(keys[6+i]))
+			}
+			root, err := trie.Root()
+			require.NoError(t, err)
+			assert.Equal(t, wantRoot, root, "round %d", round)
+		}
+
+		empty, err := NewTrie(nil)
+		require.NoError(t, err)
+		emptyRoot, err := empty.Root()
+		require.NoError(t, err)
+		for _, key := range keys {
+			want.Delete(key)
+		}
+		root, err := want.Root()
+		require.NoError(t, err)
+		assert.Equal(t, emptyRoot, root)
+	})
+
+	t.Run("proves values and absence", func(t *testing.T) {
+		for _, cfg := range []*Config{nil, {XXH128: true, Seed: 3, Secret: []byte("key")}} {
+			trie, err := NewTrie(cfg)
+			require.NoError(t, err)
+
+			for _, key := range []string{"missing", "a"} {
+				proof, err := trie.Prove(key)
+				require.NoError(t, err)
+				root, err := trie.Root()
+				require.NoError(t, err)
+				_, found, err := VerifyTrie(root, key, proof, cfg)
+				require.NoError(t, err)
+				assert.False(t, found, "empty trie")
+			}
+
+			for _, key := range keys {
+				trie.Put(key, []byte("value of "+key))
+			}
+			root, err := trie.Root()
+			require.NoError(t, err)
+
+			for _, key := range append(keys, "abe", "config", "config/tls", "c", "zzz") {
+				proof, err := trie.Prove(key)
+				require.NoError(t, err)
+
+				value, found, err := VerifyTrie(root, key, proof, cfg)
+				require.NoError(t, err)
+				want, ok := trie.Get(key)
+				assert.Equal(t, ok, found, "key %q", key)
+				assert.Equal(t, want, value, "key %q", key)
+			}
+		}
+	})
+
+	t.Run("rejects forged proofs", func(t *testing.T) {
+		trie, err := NewTrie(nil)
+		require.NoError(t, err)
+		for _, key := range keys {
+			trie.Put(key, []byte(key))
+		}
+		root, err := trie.Root()
+		require.NoError(t, err)
+
+		proof, err := trie.Prove("abc")
+		require.NoError(t, err)
+
+		// A proof for one key says nothing about another on a different path.
+		_, _, err = VerifyTrie(root, "config/timeout", proof, nil)
+		assert.ErrorIs(t, err, ErrProofMismatch)
+
+		tampered := &TrieProof{Nodes: append([][]byte(nil), proof.Nodes...)}
+		last := append([]byte(nil), tampered.Nodes[len(tampered.Nodes)-1]...)
+		last[len(last)-1] ^= 0xff
+		tampered.Nodes[len(tampered.Nodes)-1] = last
+		_, _, err = VerifyTrie(root, "abc", tampered, nil)
+		assert.ErrorIs(t, err, ErrProofMismatch)
+
+		truncated := &TrieProof{Nodes: proof.Nodes[:len(proof.Nodes)-1]}
+		_, _, err = VerifyTrie(root, "abc", truncated, nil)
+		assert.ErrorIs(t, err, ErrProofMismatch)
+
+		extended := &TrieProof{Nodes: append(append([][]byte(nil), proof.Nodes...), proof.Nodes[0])}
+		_, _, err = VerifyTrie(root, "abc", extended, nil)
+		assert.ErrorIs(t, err, ErrProofMismatch)
+
+		_, _, err = VerifyTrie(root, "abc", nil, nil)
+		assert.ErrorIs(t, err, ErrProofIsNil)
+	})
+
+	t.Run("rejects unsupported configs", func(t *testing.T) {
+		_, err := NewTrie(&Config{SealRoot: true})
+		assert.ErrorIs(t, err, ErrUnsupportedConfig)
+		_, err = NewTrie(&Config{Arity: 16})
+		assert.ErrorIs(t, err, ErrUnsupportedConfig)
+	})
+}
+
+func TestDecodeTrieNode(t *testing.T) {
+	t.Parallel()
+
+	trie, err := NewTrie(nil)
+	require.NoError(t, err)
+	trie.Put("ab", []byte("x"))
+	trie.Put("ac", []byte("y"))
+	proof, err := trie.Prove("ab")
+	require.NoError(t, err)
+
+	for _, enc := range proof.Nodes {
+		_, err := decodeTrieNode(enc, 8)
+		require.NoError(t, err)
+		for cut := 0; cut < len(enc); cut++ {
+			_, err := decodeTrieNode(enc[:cut], 8)
+			assert.ErrorIs(t, err, ErrProofMismatch, "truncated to %d of %d", cut, len(enc))
+		}
+	}
+}
+
+func BenchmarkTriePut(b *testing.B) {
+	keys := make([]string, 1<<16)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("config/%08x", uint32(i)*2654435761)
+	}
+	value := []byte("value")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		trie, _ := NewTrie(nil)
+		for _, key := range keys {
+			trie.Put(key, value)
+		}
+		_, _ = trie.Root()
+	}
+}
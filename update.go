@@ -0,0 +1,191 @@
+package merkletree
+
+// Update replaces the input of the leaf at index and recomputes the nodes on
+// its path to the root. Update may run concurrently with proof generation;
+// proofs and snapshots already handed out keep referring to the previous root.
+func (m *MerkleTree) Update(index int, input []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.update(index, input)
+}
+
+// Append adds a leaf for input at the end of the tree and recomputes the
+// right edge of every level, growing the tree by a level when needed.
+func (m *MerkleTree) Append(input []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.append(input)
+}
+
+func (m *MerkleTree) update(index int, input []byte) error {
+	if index < 0 || index >= m.LeafCount {
+		return indexError(index, m.LeafCount)
+	}
+
+	leaf, err := sproutLeaf(nil, input, m.hashFunc, m.DomainSeperation)
+	if err != nil {
+		return err
+	}
+
+	if m.leafMap != nil {
+		old, err := m.nodeAt(0, index)
+		if err != nil {
+			return err
+		}
+		if string(old) != string(leaf) {
+			m.removeLeafIndex(old, index)
+			m.addLeafIndex(leaf, index)
+		}
+	}
+
+	m.nodes[0].set(index, leaf)
+	m.padLevel(0)
+	m.relinkLeaves(index)
+	return m.rehash(index)
+}
+
+func (m *MerkleTree) append(input []byte) error {
+	leaf, err := sproutLeaf(nil, input, m.hashFunc, m.DomainSeperation)
+	if err != nil {
+		return err
+	}
+
+	index := m.LeafCount
+	m.LeafCount++
+	m.Depth = treeDepth(m.LeafCount, m.arity())
+	for len(m.nodes) < m.Depth {
+		var l *level
+		if m.storesLevel(len(m.nodes)) {
+			l = newLevel(nil, m.hashSize())
+		}
+		m.nodes = append(m.nodes, l)
+	}
+
+	// The new leaf either takes over the odd-level duplicate or is appended.
+	m.nodes[0].truncate(index)
+	m.nodes[0].set(index, leaf)
+	m.padLevel(0)
+
+	if m.leafMap != nil {
+		m.addLeafIndex(leaf, index)
+	}
+	if m.Leaves != nil {
+		m.Leaves = append(m.Leaves, nil)
+		m.relinkLeaves(index - 1)
+		m.relinkLeaves(index)
+	}
+
+	// Both the previous last leaf's path (whose padding changed) and the new
+	// leaf's path need rehashing.
+	return m.rehash(index-1, index)
+}
+
+// rehash recomputes, bottom-up, the stored nodes above the given ascending
+// leaf indices, then the root.
+func (m *MerkleTree) rehash(leaves ...int) error {
+	span := 1
+	for lvl := 1; lvl < m.Depth; lvl++ {
+		span *= m.arity()
+		for i, leaf := range leaves {
+			idx := leaf / span
+			if i > 0 && idx == leaves[i-1]/span {
+				continue
+			}
+
+			children, err := m.children(lvl, idx)
+			if err != nil {
+				return err
+			}
+			node, err := m.hashNode(children)
+			if err != nil {
+				return err
+			}
+
+			if l := m.nodes[lvl]; l != nil {
+				l.set(idx, node)
+			}
+		}
+		m.padLevel(lvl)
+	}
+
+	children, err := m.children(m.Depth, 0)
+	if err != nil {
+		return err
+	}
+	root, err := m.hashRoot(children)
+	if err != nil {
+		return err
+	}
+	m.Root = root
+	return nil
+}
+
+// padLevel fits a stored level to the tree's leaf count, repeating its last
+// node to fill the final group of siblings.
+func (m *MerkleTree) padLevel(lvl int) {
+	l := m.nodes[lvl]
+	if l == nil {
+		return
+	}
+
+	count := levelCount(m.LeafCount, lvl, m.arity())
+	l.truncate(count)
+	for i := count; i < paddedLevelCount(m.LeafCount, lvl, m.arity()); i++ {
+		l.set(i, l.node(count-1))
+	}
+}
+
+// relinkLeaves points the exported Leaves of the page holding index back at
+// the level storage after the page may have been copied.
+func (m *MerkleTree) relinkLeaves(index int) {
+	if m.Leaves == nil {
+		return
+	}
+
+	start := index - index%pageNodes
+	end := min(start+pageNodes, m.LeafCount)
+	for i := start; i < end; i++ {
+		m.Leaves[i] = m.nodes[0].node(i)
+	}
+}
+
+// addLeafIndex records that the leaf at index holds leaf. A leaf node already
+// recorded for another index keeps that index and is counted as a duplicate.
+func (m *MerkleTree) addLeafIndex(leaf []byte, index int) {
+	key := string(leaf)
+	if _, ok := m.leafMap[key]; !ok {
+		m.leafMap[key] = index
+		return
+	}
+	if m.leafDups == nil {
+		m.leafDups = make(map[string]int)
+	}
+	m.leafDups[key]++
+}
+
+// removeLeafIndex forgets that the leaf at index holds leaf, which it must
+// still do. If other leaves hold the same node and leafMap recorded index,
+// another of them is looked up in level 0.
+func (m *MerkleTree) removeLeafIndex(leaf []byte, index int) {
+	key := string(leaf)
+	dups := m.leafDups[key]
+	if dups == 0 {
+		delete(m.leafMap, key)
+		return
+	}
+
+	if dups == 1 {
+		delete(m.leafDups, key)
+	} else {
+		m.leafDups[key] = dups - 1
+	}
+	if m.leafMap[key] != index {
+		return
+	}
+	for i := 0; i < m.LeafCount; i++ {
+		if i != index && string(m.nodes[0].node(i)) == key {
+			m.leafMap[key] = i
+			return
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package merkletree
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("matches a rebuilt tree", func(t *testing.T) {
+		configs := []Config{
+			{},
+			{DomainSeperation: true, SealRoot: true},
+			{XXH128: true, LevelInterval: 2},
+			{DomainSeperation: true, LevelInterval: 64},
+		}
+
+		for _, n := range []int{2, 3, 5, 8, 13} {
+			for _, cfg := range configs {
+				cfg := cfg
+				input := generateRandomInputs(t, n)
+				tree, err := New(&cfg, input)
+				require.NoError(t, err)
+
+				for i := 0; i < n; i++ {
+					input[i] = generateRandomInputs(t, 1)[0]
+					require.NoError(t, tree.Update(i, input[i]))
+
+					rebuilt, err := New(&cfg, input)
+					require.NoError(t, err)
+					assert.Equal(t, rebuilt.Root, tree.Root, "root mismatch after updating leaf %d of %d (%+v)", i, n, cfg)
+					assert.Equal(t, rebuilt.Leaves, tree.Leaves)
+
+					for j := range input {
+						proof, err := tree.ProofFromInput(input[j])
+						require.NoError(t, err)
+						ok, err := tree.Verify(input[j], tree.Root, proof, nil)
+						require.NoError(t, err)
+						assert.True(t, ok, "proof for leaf %d invalid after update", j)
+					}
+				}
+			}
+		}
+	})
+
+	t.Run("replaces the leaf in the reverse map", func(t *testing.T) {
+		input := generateRandomInputs(t, 4)
+		tree, err := New(nil, input)
+		require.NoError(t, err)
+
+		replacement := []byte("replacement")
+		require.NoError(t, tree.Update(2, replacement))
+
+		_, err = tree.ProofFromInput(input[2])
+		assert.ErrorIs(t, err, ErrProofInvalidLeaf)
+
+		proof, err := tree.ProofFromInput(replacement)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), proof.Index)
+	})
+
+	t.Run("keeps duplicate leaves in the reverse map", func(t *testing.T) {
+		input := [][]byte{[]byte("x"), []byte("a"), []byte("y"), []byte("a"), []byte("z")}
+		for _, updated := range []int{1, 3} {
+			tree, err := New(nil, input)
+			require.NoError(t, err)
+
+			require.NoError(t, tree.Update(updated, []byte("b")))
+			remaining := 4 - updated
+
+			index, err := tree.IndexOf([]byte("a"))
+			require.NoError(t, err, "after updating leaf %d", updated)
+			assert.Equal(t, remaining, index)
+			proof, err := tree.ProofFromInput([]byte("a"))
+			require.NoError(t, err)
+			assert.Equal(t, uint64(remaining), proof.Index)
+
+			// Once the last copy goes, so does the entry.
+			require.NoError(t, tree.Update(remaining, []byte("c")))
+			_, err = tree.IndexOf([]byte("a"))
+			assert.ErrorIs(t, err, ErrProofInvalidLeaf)
+
+			// A duplicate added again is found, and survives its twin's update.
+			require.NoError(t, tree.Append([]byte("b")))
+			require.NoError(t, tree.Update(updated, []byte("d")))
+			index, err = tree.IndexOf([]byte("b"))
+			require.NoError(t, err)
+			assert.Equal(t, 5, index)
+		}
+	})
+
+	t.Run("earlier proofs are not affected", func(t *testing.T) {
+		input := generateRandomInputs(t, 4)
+		tree, err := New(nil, input)
+		require.NoError(t, err)
+
+		oldRoot := tree.CurrentRoot()
+		proof, err := tree.Proof(0)
+		require.NoError(t, err)
+
+		require.NoError(t, tree.Update(1, []byte("changed")))
+		assert.NotEqual(t, oldRoot, tree.CurrentRoot())
+
+		ok, err := Verify(input[0], oldRoot, proof, nil)
+		require.NoError(t, err)
+		assert.True(t, ok, "proof should still verify against the root it was generated for")
+	})
+
+	t.Run("rejects out of range index", func(t *testing.T) {
+		tree, err := New(nil, generateRandomInputs(t, 4))
+		require.NoError(t, err)
+		assert.ErrorIs(t, tree.Update(4, []byte("x")), ErrProofInvalidIndex)
+		assert.ErrorIs(t, tree.Update(-1, []byte("x")), ErrProofInvalidIndex)
+	})
+}
+
+func TestAppend(t *testing.T) {
+	t.Parallel()
+
+	configs := []Config{
+		{},
+		{DomainSeperation: true, SealRoot: true},
+		{XXH128: true, LevelInterval: 2},
+		{DomainSeperation: true, LevelInterval: 64},
+	}
+
+	for _, cfg := range configs {
+		cfg := cfg
+		input := generateRandomInputs(t, 2)
+		tree, err := New(&cfg, input)
+		require.NoError(t, err)
+
+		for n := 3; n <= 40; n++ {
+			data := generateRandomInputs(t, 1)[0]
+			input = append(input, data)
+			require.NoError(t, tree.Append(data))
+
+			rebuilt, err := New(&cfg, input)
+			require.NoError(t, err)
+			require.Equal(t, rebuilt.Root, tree.Root, "root mismatch after appending leaf %d (%+v)", n, cfg)
+			require.Equal(t, rebuilt.Depth, tree.Depth)
+			require.Equal(t, rebuilt.Leaves, tree.Leaves)
+
+			for i := range input {
+				want, err := rebuilt.Proof(i)
+				require.NoError(t, err)
+				got, err := tree.ProofFromInput(input[i])
+				require.NoError(t, err)
+				require.Equal(t, want, got, "proof mismatch for leaf %d of %d (%+v)", i, n, cfg)
+			}
+		}
+	}
+
+	t.Run("across page boundaries", func(t *testing.T) {
+		input := generateRandomInputs(t, pageNodes-3)
+		tree, err := New(nil, input)
+		require.NoError(t, err)
+
+		for i := 0; i < 8; i++ {
+			data := generateRandomInputs(t, 1)[0]
+			input = append(input, data)
+			require.NoError(t, tree.Append(data))
+		}
+
+		rebuilt, err := New(nil, input)
+		require.NoError(t, err)
+		assert.Equal(t, rebuilt.Root, tree.Root)
+		assert.Equal(t, rebuilt.Leaves, tree.Leaves)
+	})
+}
+
+// Run with -race to check the concurrency guarantees documented on MerkleTree.
+func TestConcurrentProofsAndUpdates(t *testing.T) {
+	const (
+		leaves  = 64
+		readers = 8
+		rounds  = 200
+	)
+
+	input := generateRandomInputs(t, leaves)
+	tree, err := New(&Config{DomainSeperation: true}, input)
+	require.NoError(t, err)
+
+	// Readers only ask for leaves that the writer never touches, so every
+	// lookup by input must succeed throughout.
+	stable := input[:leaves/2]
+
+	var wg sync.WaitGroup
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				idx := (r + i) % len(stable)
+				if _, err := tree.Proof(idx); err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := tree.ProofFromInput(stable[idx]); err != nil {
+					t.Error(err)
+					return
+				}
+				if root := tree.CurrentRoot(); len(root) != tree.hashSize() {
+					t.Errorf("unexpected root length %d", len(root))
+					return
+				}
+			}
+		}(r)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			idx := leaves/2 + i%(leaves/2)
+			input[idx] = []byte{byte(i), byte(idx)}
+			if err := tree.Update(idx, input[idx]); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	rebuilt, err := New(&Config{DomainSeperation: true}, input)
+	require.NoError(t, err)
+	assert.Equal(t, rebuilt.Root, tree.CurrentRoot())
+}
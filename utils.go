@@ -2,10 +2,26 @@ package merkletree
 
 import (
 	"encoding/binary"
+	"sync"
 
 	"github.com/zeebo/xxh3"
 )
 
+// appendHashFunc appends the hash of input to dst, so that nodes can be hashed
+// straight into preallocated level buffers.
+type appendHashFunc func(dst, input []byte) ([]byte, error)
+
+// appendHashFuncOf adapts a TypeHashFunc to an appendHashFunc.
+func appendHashFuncOf(hashFunc TypeHashFunc) appendHashFunc {
+	return func(dst, input []byte) ([]byte, error) {
+		h, err := hashFunc(input)
+		if err != nil {
+			return dst, err
+		}
+		return append(dst, h...), nil
+	}
+}
+
 // concatBytes concatenates two byte slices.
 func concatBytes(a, b []byte) []byte {
 	output := make([]byte, len(a)+len(b))
@@ -14,17 +30,101 @@ func concatBytes(a, b []byte) []byte {
 	return output
 }
 
+// appendNodeInput writes the hash input of an internal node into dst, reusing its capacity.
+func appendNodeInput(dst, left, right []byte, domainSeparation bool) []byte {
+	dst = dst[:0]
+	if domainSeparation {
+		dst = append(dst, nodePrefix)
+	}
+	dst = append(dst, left...)
+	return append(dst, right...)
+}
+
+// appendChildrenInput writes the hash input of an internal node over its
+// concatenated children into dst, reusing its capacity.
+func appendChildrenInput(dst, children []byte, domainSeparation bool) []byte {
+	dst = dst[:0]
+	if domainSeparation {
+		dst = append(dst, nodePrefix)
+	}
+	return append(dst, children...)
+}
+
+// appendPathInput writes the hash input of the parent of node into dst, node
+// being child pos and siblings the other children in order.
+func appendPathInput(dst []byte, siblings [][]byte, pos int, node []byte, domainSeparation bool) []byte {
+	dst = dst[:0]
+	if domainSeparation {
+		dst = append(dst, nodePrefix)
+	}
+	for _, sib := range siblings[:pos] {
+		dst = append(dst, sib...)
+	}
+	dst = append(dst, node...)
+	for _, sib := range siblings[pos:] {
+		dst = append(dst, sib...)
+	}
+	return dst
+}
+
+// newHashFunc returns the hash function described by config. The default
+// (zero) seed without a secret hashes exactly like xxh3Hash64/xxh3Hash128.
+func newHashFunc(config *Config) appendHashFunc {
+	if config.Seed == 0 && len(config.Secret) == 0 {
+		if config.XXH128 {
+			return appendXXH3Hash128
+		}
+		return appendXXH3Hash64
+	}
+
+	seed := config.Seed
+	hash := appendXXH3Hash64Seed
+	if config.XXH128 {
+		hash = appendXXH3Hash128Seed
+	}
+	if len(config.Secret) == 0 {
+		return func(dst, input []byte) ([]byte, error) {
+			return hash(dst, input, seed)
+		}
+	}
+
+	// The secret is prepended to every input in a scratch buffer reused
+	// between calls, so that keyed hashing does not allocate.
+	secret := append([]byte(nil), config.Secret...)
+	scratch := &sync.Pool{New: func() any { return new([]byte) }}
+	return func(dst, input []byte) ([]byte, error) {
+		buf := scratch.Get().(*[]byte)
+		*buf = append(append((*buf)[:0], secret...), input...)
+		dst, err := hash(dst, *buf, seed)
+		scratch.Put(buf)
+		return dst, err
+	}
+}
+
 func xxh3Hash64(input []byte) ([]byte, error) {
-	h64 := xxh3.Hash(input) // 64-bit default
-	buf := make([]byte, 8)
-	binary.LittleEndian.PutUint64(buf, h64)
-	return buf, nil
+	return appendXXH3Hash64(make([]byte, 0, 8), input)
 }
 
 func xxh3Hash128(input []byte) ([]byte, error) {
+	return appendXXH3Hash128(make([]byte, 0, 16), input)
+}
+
+func appendXXH3Hash64(dst, input []byte) ([]byte, error) {
+	return binary.LittleEndian.AppendUint64(dst, xxh3.Hash(input)), nil // 64-bit default
+}
+
+func appendXXH3Hash128(dst, input []byte) ([]byte, error) {
 	h128 := xxh3.Hash128(input)
-	buf := make([]byte, 16)
-	binary.BigEndian.PutUint64(buf[0:8], h128.Hi)
-	binary.BigEndian.PutUint64(buf[8:16], h128.Lo)
-	return buf, nil
+	dst = binary.BigEndian.AppendUint64(dst, h128.Hi)
+	return binary.BigEndian.AppendUint64(dst, h128.Lo), nil
+}
+
+func appendXXH3Hash64Seed(dst, input []byte, seed uint64) ([]byte, error) {
+	return binary.LittleEndian.AppendUint64(dst, xxh3.HashSeed(input, seed)), nil
+}
+
+func appendXXH3Hash128Seed(dst, input []byte, seed uint64) ([]byte, error) {
+	h128 := xxh3.Hash128Seed(input, seed)
+	dst = binary.BigEndian.AppendUint64(dst, h128.Hi)
+	return binary.BigEndian.AppendUint64(dst, h128.Lo), nil
 }
@@ -0,0 +1,285 @@
+package merkletree
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zeebo/xxh3"
+)
+
+// Verifier checks many proofs against a single root. The hash function is
+// selected once, buffers are reused between calls, and the internal nodes of
+// accepted proofs are remembered along with a digest of the siblings above
+// them: a later proof stops hashing as soon as it reaches a node already known
+// to lead to the root through the same siblings. The cache holds at most one
+// entry per internal node of the tree. A Verifier is safe for concurrent use.
+type Verifier struct {
+	// Parallelism bounds the goroutines used by VerifyBatch. 0 uses
+	// GOMAXPROCS and 1 verifies sequentially.
+	Parallelism int
+
+	root     []byte
+	config   *Config
+	hashFunc appendHashFunc
+	width    int
+
+	mu       sync.RWMutex
+	verified map[nodePosition]verifiedNode
+	// sealedCount is the leaf count a sealed root commits to, learned from the
+	// first accepted proof. Only proofs with the same count may use the cache.
+	sealedCount int
+
+	scratch sync.Pool
+}
+
+// nodePosition identifies an internal node by its level and its position
+// within the level.
+type nodePosition struct {
+	level int
+	pos   uint64
+}
+
+// verifiedNode is an internal node on the path of an accepted proof: its hash
+// and the upperDigest of that proof's siblings from the node's level up.
+type verifiedNode struct {
+	hash  [16]byte
+	upper xxh3.Uint128
+}
+
+// verifyScratch holds the buffers used by a single verification.
+type verifyScratch struct {
+	input    []byte
+	combined []byte
+	cur      []byte
+	spare    []byte
+	// path holds the hashes of the internal nodes computed so far.
+	path []byte
+	// starts holds, for each level, the index of its first recorded sibling.
+	starts []int
+	digest *xxh3.Hasher
+	// siblings holds the expanded siblings of a level of a compact proof.
+	siblings [][]byte
+}
+
+// NewVerifier returns a Verifier for proofs against root. If config is nil,
+// the default configuration is used.
+func NewVerifier(root []byte, config *Config) *Verifier {
+	if config == nil {
+		config = new(Config)
+	}
+	v := &Verifier{
+		root:     bytes.Clone(root),
+		config:   config,
+		hashFunc: newHashFunc(config),
+		width:    8,
+		verified: make(map[nodePosition]verifiedNode),
+	}
+	if config.XXH128 {
+		v.width = 16
+	}
+	v.scratch.New = func() any {
+		return &verifyScratch{
+			cur:    make([]byte, 0, v.width),
+			spare:  make([]byte, 0, v.width),
+			digest: xxh3.New(),
+		}
+	}
+	return v
+}
+
+// Verify checks that input is the leaf proven by proof. It returns the same
+// results and errors as the package-level Verify with the Verifier's config.
+func (v *Verifier) Verify(input []byte, proof *Proof) (bool, error) {
+	if input == nil {
+		return false, ErrInputIsNil
+	}
+	if proof == nil {
+		return false, ErrProofIsNil
+	}
+	if err := v.config.validate(); err != nil {
+		return false, err
+	}
+	if err := proof.check(v.config); err != nil {
+		return false, err
+	}
+
+	if v.config.SealRoot && proof.LeafCount <= 1 {
+		return false, ErrProofLeafCount
+	}
+	k := v.config.arity()
+	if _, ok := proofLength(proof, k); !ok {
+		return false, nil
+	}
+	depth := proof.siblingCount() / (k - 1)
+	if err := checkIndex(proof, depth, k); err != nil {
+		return false, err
+	}
+
+	var meta []byte
+	useCache := true
+	if v.config.SealRoot {
+		meta = treeMetadata(proof.LeafCount, v.config)
+		v.mu.RLock()
+		useCache = v.sealedCount == proof.LeafCount
+		v.mu.RUnlock()
+	}
+
+	s := v.scratch.Get().(*verifyScratch)
+	defer v.scratch.Put(s)
+
+	s.input = s.input[:0]
+	if v.config.DomainSeperation {
+		s.input = append(s.input, leafPrefix)
+	}
+	s.input = append(s.input, input...)
+
+	cur, err := v.hashFunc(s.cur[:0], s.input)
+	if err != nil {
+		return false, err
+	}
+	spare := s.spare
+	defer func() { s.cur, s.spare = cur[:0], spare[:0] }()
+
+	s.path, s.starts = s.path[:0], s.starts[:0]
+	path, next := proof.Index, 0
+	for level := 0; level < depth; level++ {
+		start := next
+		if len(proof.Omitted) == 0 {
+			start = level * (k - 1)
+		}
+		s.starts = append(s.starts, start)
+
+		if level > 0 {
+			// path is now the node's index within its level
+			if useCache && v.known(level, path, cur, s.upperDigest(proof, level, start)) {
+				v.remember(proof, s)
+				return true, nil
+			}
+			s.path = append(s.path, cur...)
+		}
+
+		pos := int(path % uint64(k))
+		s.siblings = proof.levelSiblings(s.siblings, level, k, pos, cur, &next)
+		s.combined = appendPathInput(s.combined, s.siblings, pos, cur, v.config.DomainSeperation)
+		if meta != nil && level == depth-1 {
+			s.combined = append(s.combined, meta...)
+		}
+
+		next, err := v.hashFunc(spare[:0], s.combined)
+		if err != nil {
+			return false, fmt.Errorf("merkletree: hashing level %d: %w", level+1, err)
+		}
+		cur, spare = next, cur
+
+		path /= uint64(k)
+	}
+
+	if !bytes.Equal(cur, v.root) {
+		return false, nil
+	}
+	v.remember(proof, s)
+	return true, nil
+}
+
+// VerifyBatch verifies inputs[i] against proofs[i] for every i, spreading the
+// work over up to Parallelism goroutines. If any verification fails with an
+// error, the error of the lowest such index is returned alongside the results.
+func (v *Verifier) VerifyBatch(inputs [][]byte, proofs []*Proof) ([]bool, error) {
+	if len(inputs) != len(proofs) {
+		return nil, ErrBatchLength
+	}
+
+	results := make([]bool, len(inputs))
+	errs := make([]error, len(inputs))
+
+	workers := v.Parallelism
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, len(inputs))
+
+	if workers <= 1 {
+		for i := range inputs {
+			results[i], errs[i] = v.Verify(inputs[i], proofs[i])
+		}
+	} else {
+		var (
+			next atomic.Int64
+			wg   sync.WaitGroup
+		)
+		wg.Add(workers)
+		for w := 0; w < workers; w++ {
+			go func() {
+				defer wg.Done()
+				for {
+					i := int(next.Add(1) - 1)
+					if i >= len(inputs) {
+						return
+					}
+					results[i], errs[i] = v.Verify(inputs[i], proofs[i])
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	for i, err := range errs {
+		if err != nil {
+			return results, fmt.Errorf("proof %d: %w", i, err)
+		}
+	}
+	return results, nil
+}
+
+// known reports whether the node was on the path of an accepted proof with
+// the same siblings above it. The remaining levels then hash to the root.
+func (v *Verifier) known(level int, pos uint64, hash []byte, upper xxh3.Uint128) bool {
+	v.mu.RLock()
+	node, ok := v.verified[nodePosition{level: level, pos: pos}]
+	v.mu.RUnlock()
+	return ok && node.upper == upper && bytes.Equal(node.hash[:len(hash)], hash)
+}
+
+// remember records the internal nodes of an accepted proof, s.path holding
+// the hashes of levels 1 and up.
+func (v *Verifier) remember(proof *Proof, s *verifyScratch) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.config.SealRoot && v.sealedCount == 0 {
+		v.sealedCount = proof.LeafCount
+	}
+	pos := proof.Index
+	for i := 0; i*v.width < len(s.path); i++ {
+		pos /= uint64(v.config.arity())
+		node := verifiedNode{upper: s.upperDigest(proof, i+1, s.starts[i+1])}
+		copy(node.hash[:], s.path[i*v.width:(i+1)*v.width])
+		v.verified[nodePosition{level: i + 1, pos: pos}] = node
+	}
+}
+
+// upperDigest hashes what the proof records from level up: its siblings from
+// the recorded sibling start on and, for a compact proof, which of those
+// levels' siblings are omitted. Proofs through the same node with the same
+// digest hash to the same root.
+func (s *verifyScratch) upperDigest(proof *Proof, level, start int) xxh3.Uint128 {
+	s.digest.Reset()
+	for _, sib := range proof.Siblings[start:] {
+		_, _ = s.digest.Write(sib)
+	}
+	if len(proof.Omitted) != 0 {
+		perLevel := proof.Config().arity() - 1
+		var bit [1]byte
+		for i := level * perLevel; i < proof.siblingCount(); i++ {
+			bit[0] = 0
+			if proof.omitted(i) {
+				bit[0] = 1
+			}
+			_, _ = s.digest.Write(bit[:])
+		}
+	}
+	return s.digest.Sum128()
+}
@@ -0,0 +1,242 @@
+package merkletree
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// allProofs returns a proof for every leaf of tree.
+func allProofs(t testing.TB, tree *MerkleTree) []*Proof {
+	proofs := make([]*Proof, tree.LeafCount)
+	for i := range proofs {
+		var err error
+		proofs[i], err = tree.Proof(i)
+		require.NoError(t, err)
+	}
+	return proofs
+}
+
+func TestVerifier(t *testing.T) {
+	t.Parallel()
+
+	t.Run("agrees with Verify", func(t *testing.T) {
+		for _, cfg := range []*Config{
+			{},
+			{DomainSeperation: true},
+			{XXH128: true, DomainSeperation: true, SealRoot: true},
+			{Seed: 9, Secret: []byte("key")},
+		} {
+			input := generateRandomInputs(t, 13)
+			tree, err := New(cfg, input)
+			require.NoError(t, err)
+			v := NewVerifier(tree.Root, cfg)
+
+			// Twice, so that the second pass is served from the cache.
+			for pass := 0; pass < 2; pass++ {
+				for i, proof := range allProofs(t, tree) {
+					ok, err := v.Verify(input[i], proof)
+					require.NoError(t, err)
+					assert.True(t, ok, "leaf %d, pass %d", i, pass)
+
+					ok, err = v.Verify(input[(i+1)%len(input)], proof)
+					require.NoError(t, err)
+					assert.False(t, ok, "wrong input for leaf %d, pass %d", i, pass)
+				}
+			}
+		}
+	})
+
+	t.Run("cache does not accept forged lower levels", func(t *testing.T) {
+		input := generateRandomInputs(t, 8)
+		tree, err := New(nil, input)
+		require.NoError(t, err)
+		v := NewVerifier(tree.Root, nil)
+
+		proofs := allProofs(t, tree)
+		for i, proof := range proofs {
+			ok, err := v.Verify(input[i], proof)
+			require.NoError(t, err)
+			require.True(t, ok)
+		}
+
+		forged := *proofs[2]
+		forged.Siblings = append([][]byte{bytes.Repeat([]byte{0xAB}, 8)}, proofs[2].Siblings[1:]...)
+		ok, err := v.Verify(input[2], &forged)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		moved := *proofs[2]
+		moved.Index = 6
+		ok, err = v.Verify(input[2], &moved)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("cache hits still check the upper siblings", func(t *testing.T) {
+		for _, cfg := range []*Config{{}, {Arity: 3, DomainSeperation: true}} {
+			input := generateRandomInputs(t, 13)
+			tree, err := New(cfg, input)
+			require.NoError(t, err)
+			v := NewVerifier(tree.Root, cfg)
+
+			proofs := allProofs(t, tree)
+			for i, proof := range proofs {
+				ok, err := v.Verify(input[i], proof)
+				require.NoError(t, err)
+				require.True(t, ok)
+			}
+
+			for i, proof := range proofs {
+				for _, p := range []*Proof{proof, proof.Compact()} {
+					for j := range p.Siblings {
+						tampered := *p
+						tampered.Siblings = append([][]byte(nil), p.Siblings...)
+						tampered.Siblings[j] = make([]byte, len(p.Siblings[j]))
+
+						want, err := Verify(input[i], tree.Root, &tampered, cfg)
+						require.NoError(t, err)
+						got, err := v.Verify(input[i], &tampered)
+						require.NoError(t, err)
+						assert.Equal(t, want, got, "leaf %d, sibling %d", i, j)
+						assert.False(t, got, "leaf %d, sibling %d", i, j)
+					}
+
+					ok, err := v.Verify(input[i], p)
+					require.NoError(t, err)
+					assert.True(t, ok, "leaf %d", i)
+				}
+			}
+		}
+
+		// Leaf 1's proof shares every node above level 0 with leaf 0's.
+		input := generateRandomInputs(t, 8)
+		tree, err := New(nil, input)
+		require.NoError(t, err)
+		v := NewVerifier(tree.Root, nil)
+		proofs := allProofs(t, tree)
+		ok, err := v.Verify(input[0], proofs[0])
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		proofs[1].Siblings[2] = make([]byte, 8)
+		ok, err = v.Verify(input[1], proofs[1])
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("sealed roots check the leaf count", func(t *testing.T) {
+		input := generateRandomInputs(t, 5)
+		cfg := &Config{SealRoot: true}
+		tree, err := New(cfg, input)
+		require.NoError(t, err)
+		v := NewVerifier(tree.Root, cfg)
+
+		proof, err := tree.Proof(0)
+		require.NoError(t, err)
+		ok, err := v.Verify(input[0], proof)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		replayed, err := tree.Proof(1)
+		require.NoError(t, err)
+		replayed.LeafCount = 6
+		ok, err = v.Verify(input[1], replayed)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("reports the same errors as Verify", func(t *testing.T) {
+		input := generateRandomInputs(t, 4)
+		tree, err := New(&Config{DomainSeperation: true}, input)
+		require.NoError(t, err)
+		proof, err := tree.Proof(0)
+		require.NoError(t, err)
+
+		_, err = NewVerifier(tree.Root, nil).Verify(input[0], proof)
+		assert.ErrorIs(t, err, ErrConfigMismatch)
+
+		v := NewVerifier(tree.Root, tree.Config)
+		_, err = v.Verify(nil, proof)
+		assert.ErrorIs(t, err, ErrInputIsNil)
+		_, err = v.Verify(input[0], nil)
+		assert.ErrorIs(t, err, ErrProofIsNil)
+	})
+
+	t.Run("verifies batches in parallel", func(t *testing.T) {
+		input := generateRandomInputs(t, 300)
+		tree, err := New(nil, input)
+		require.NoError(t, err)
+		proofs := allProofs(t, tree)
+
+		inputs := append([][]byte(nil), input...)
+		inputs[17] = []byte("tampered")
+
+		for _, parallelism := range []int{0, 1, 4} {
+			v := NewVerifier(tree.Root, nil)
+			v.Parallelism = parallelism
+
+			results, err := v.VerifyBatch(inputs, proofs)
+			require.NoError(t, err)
+			for i, ok := range results {
+				assert.Equal(t, i != 17, ok, "leaf %d with parallelism %d", i, parallelism)
+			}
+		}
+	})
+
+	t.Run("batch errors carry the index", func(t *testing.T) {
+		input := generateRandomInputs(t, 4)
+		tree, err := New(nil, input)
+		require.NoError(t, err)
+		proofs := allProofs(t, tree)
+		proofs[2] = nil
+
+		v := NewVerifier(tree.Root, nil)
+		results, err := v.VerifyBatch(input, proofs)
+		assert.ErrorIs(t, err, ErrProofIsNil)
+		assert.EqualError(t, err, "proof 2: proof is nil")
+		assert.Equal(t, []bool{true, true, false, true}, results)
+
+		_, err = v.VerifyBatch(input[:3], proofs)
+		assert.ErrorIs(t, err, ErrBatchLength)
+	})
+}
+
+func BenchmarkVerifier(b *testing.B) {
+	input := make([][]byte, 1<<14)
+	for i := range input {
+		input[i] = []byte{byte(i), byte(i >> 8), 0xAA}
+	}
+	tree, err := New(&Config{DomainSeperation: true}, input)
+	require.NoError(b, err)
+	proofs := allProofs(b, tree)
+
+	b.Run("Verify", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			j := i % len(input)
+			_, _ = Verify(input[j], tree.Root, proofs[j], tree.Config)
+		}
+	})
+
+	b.Run("Verifier", func(b *testing.B) {
+		v := NewVerifier(tree.Root, tree.Config)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			j := i % len(input)
+			_, _ = v.Verify(input[j], proofs[j])
+		}
+	})
+
+	b.Run("VerifyBatch", func(b *testing.B) {
+		v := NewVerifier(tree.Root, tree.Config)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_, _ = v.VerifyBatch(input, proofs)
+		}
+	})
+}
@@ -1,63 +1,262 @@
 package merkletree
 
-import "bytes"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// VerifyReason classifies the outcome of VerifyDetailed.
+type VerifyReason int
+
+const (
+	VerifyOK             VerifyReason = iota // the proof is valid
+	VerifyRootMismatch                       // the recomputed root differs from the expected one
+	VerifySiblingLength                      // a sibling does not have the hash width or is wrongly omitted
+	VerifyDepthMismatch                      // the sibling count does not fit the leaf count
+	VerifyConfigMismatch                     // the proof was generated with a different config
+)
+
+func (r VerifyReason) String() string {
+	switch r {
+	case VerifyOK:
+		return "ok"
+	case VerifyRootMismatch:
+		return "root mismatch"
+	case VerifySiblingLength:
+		return "sibling length"
+	case VerifyDepthMismatch:
+		return "depth mismatch"
+	case VerifyConfigMismatch:
+		return "config mismatch"
+	default:
+		return "unknown"
+	}
+}
+
+// VerifyResult describes how a proof was checked and why it failed.
+type VerifyResult struct {
+	Reason VerifyReason
+	// Err details a failed verification and matches ErrRootMismatch,
+	// ErrSiblingLength, ErrInvalidOmitted, ErrDepthMismatch or ErrConfigMismatch
+	// with errors.Is.
+	// It is nil when the proof is valid.
+	Err error
+	// Root recomputed from the input and the proof. Nil if verification
+	// stopped before hashing.
+	Root Root
+	// Hashes on the path from the leaf to the root: Levels[0] is the leaf hash
+	// and Levels[len(Siblings)] is the recomputed root.
+	Levels [][]byte
+}
+
+// OK reports whether the proof is valid.
+func (r *VerifyResult) OK() bool {
+	return r.Reason == VerifyOK
+}
+
+// Verify checks a proof against the given root. If config is nil, the tree's own
+// configuration is used.
+func (m *MerkleTree) Verify(input []byte, root []byte, proof *Proof, config *Config) (bool, error) {
+	if config == nil {
+		config = m.Config
+	}
+	return Verify(input, root, proof, config)
+}
 
 // Checks if the leaf data is valid for a given Merkle tree proof root hash.
+// If config is nil, the hash algorithm and modes recorded in the proof are
+// used. Otherwise a proof recorded with different modes, or with siblings of
+// the wrong width, is rejected with a *ConfigMismatchError or *SiblingLengthError.
+// An index past the proof's leaf count, or past the leaves of a tree of the
+// proof's depth, is rejected with ErrProofInvalidIndex.
+// Compact proofs are expanded as they are checked.
 func Verify(input []byte, root []byte, proof *Proof, config *Config) (bool, error) {
+	var res VerifyResult
+	if err := verify(input, root, proof, config, &res, false); err != nil {
+		return false, err
+	}
+	switch res.Reason {
+	case VerifyConfigMismatch, VerifySiblingLength:
+		return false, res.Err
+	}
+	return res.OK(), nil
+}
+
+// VerifyDetailed is like Verify but reports the recomputed root, the hash at
+// every level and the reason a proof is rejected. The returned error is only
+// set for unusable arguments or a failing hash function; rejected proofs are
+// described by the result.
+func VerifyDetailed(input []byte, root []byte, proof *Proof, config *Config) (*VerifyResult, error) {
+	res := new(VerifyResult)
+	if err := verify(input, root, proof, config, res, true); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// verify fills res with the outcome of checking proof. The per-level hashes
+// are only kept when record is set.
+func verify(input []byte, root []byte, proof *Proof, config *Config, res *VerifyResult, record bool) error {
 	if input == nil {
-		return false, ErrInputIsNil
+		return ErrInputIsNil
 	}
 
 	if proof == nil {
-		return false, ErrProofIsNil
+		return ErrProofIsNil
 	}
 
 	if config == nil {
-		config = new(Config)
+		config = proof.Config()
+	}
+	if err := config.validate(); err != nil {
+		return err
+	}
+	if err := proof.check(config); err != nil {
+		res.Reason, res.Err = VerifySiblingLength, err
+		if errors.Is(err, ErrConfigMismatch) {
+			res.Reason = VerifyConfigMismatch
+		}
+		return nil
 	}
 
-	var hashFunc TypeHashFunc
-	if config.XXH128 {
-		hashFunc = xxh3Hash128
-	} else {
-		hashFunc = xxh3Hash64
+	if config.SealRoot && proof.LeafCount <= 1 {
+		return ErrProofLeafCount
+	}
+	k := config.arity()
+	if want, ok := proofLength(proof, k); !ok {
+		res.Reason = VerifyDepthMismatch
+		res.Err = &DepthMismatchError{LeafCount: proof.LeafCount, Got: proof.siblingCount(), Want: want}
+		return nil
+	}
+	depth := proof.siblingCount() / (k - 1)
+	if err := checkIndex(proof, depth, k); err != nil {
+		return err
 	}
 
-	leaf, err := sproutLeaf(input, hashFunc, config.DomainSeperation)
-	if err != nil {
-		return false, err
+	var meta []byte
+	if config.SealRoot {
+		meta = treeMetadata(proof.LeafCount, config)
 	}
 
-	result := make([]byte, len(leaf))
-	copy(result, leaf)
+	hashFunc := newHashFunc(config)
 
+	result, err := sproutLeaf(nil, input, hashFunc, config.DomainSeperation)
+	if err != nil {
+		return err
+	}
+	if record {
+		res.Levels = make([][]byte, 0, depth+1)
+		res.Levels = append(res.Levels, result)
+	}
+
+	var (
+		combined []byte
+		siblings [][]byte
+		next     int
+	)
 	path := proof.Index
-	for _, sib := range proof.Siblings {
-		var combined []byte
-
-		if path&1 == 1 {
-			// Right child: left = sibling, right = result
-			if config.DomainSeperation {
-				combined = concatBytes([]byte{nodePrefix}, concatBytes(sib, result))
-			} else {
-				combined = concatBytes(sib, result)
-			}
-		} else {
-			// Left child: left = result, right = sibling
-			if config.DomainSeperation {
-				combined = concatBytes([]byte{nodePrefix}, concatBytes(result, sib))
-			} else {
-				combined = concatBytes(result, sib)
-			}
+	for level := 0; level < depth; level++ {
+		// For a binary tree, position 1 means a right child whose sibling
+		// is on the left.
+		pos := int(path % uint64(k))
+		siblings = proof.levelSiblings(siblings, level, k, pos, result, &next)
+		combined = appendPathInput(combined, siblings, pos, result, config.DomainSeperation)
+
+		if meta != nil && level == depth-1 {
+			combined = append(combined, meta...)
 		}
 
-		result, err = hashFunc(combined)
+		if record {
+			// keep the previous level's hash
+			result = nil
+		}
+		result, err = hashFunc(result[:0], combined)
 		if err != nil {
-			return false, err
+			return fmt.Errorf("merkletree: hashing level %d: %w", level+1, err)
+		}
+		if record {
+			res.Levels = append(res.Levels, result)
 		}
 
-		path >>= 1
+		path /= uint64(k)
 	}
 
-	return bytes.Equal(result, root), nil
+	res.Root = result
+	if !bytes.Equal(result, root) {
+		res.Reason = VerifyRootMismatch
+		res.Err = fmt.Errorf("%w: got %x, want %x", ErrRootMismatch, result, root)
+	}
+	return nil
+}
+
+// Config returns a Config holding the hash algorithm and modes recorded in the
+// proof. Seed and Secret are never recorded and must be supplied separately.
+func (p *Proof) Config() *Config {
+	return &Config{XXH128: p.XXH128, DomainSeperation: p.DomainSeperation, SealRoot: p.SealRoot, Arity: p.Arity}
+}
+
+// proofLength reports whether the proof holds a whole number of levels of
+// arity-1 siblings and, if it records its leaf count, exactly the number of
+// levels of that tree. It also returns the expected number of siblings, or 0
+// for a leaf count above maxLeafCount.
+func proofLength(p *Proof, arity int) (int, bool) {
+	perLevel, got := arity-1, p.siblingCount()
+	if p.LeafCount > maxLeafCount {
+		return 0, false
+	}
+	if p.LeafCount > 0 {
+		want := treeDepth(p.LeafCount, arity) * perLevel
+		return want, got == want
+	}
+	want := (got + perLevel - 1) / perLevel * perLevel
+	return want, got == want
+}
+
+// checkIndex rejects an index past the proof's leaf count, if it records one,
+// or past the leaves of a tree of the given depth and arity.
+func checkIndex(p *Proof, depth, arity int) error {
+	if p.LeafCount > 0 && p.Index >= uint64(p.LeafCount) {
+		return fmt.Errorf("%w: %d not in [0, %d)", ErrProofInvalidIndex, p.Index, p.LeafCount)
+	}
+	rest := p.Index
+	for level := 0; level < depth && rest > 0; level++ {
+		rest /= uint64(arity)
+	}
+	if rest != 0 {
+		return fmt.Errorf("%w: %d is past the leaves of a proof of depth %d", ErrProofInvalidIndex, p.Index, depth)
+	}
+	return nil
+}
+
+// check reports whether the proof was generated with the given config, has
+// siblings of the config's hash width and, if compact, a usable Omitted bitmap.
+func (p *Proof) check(config *Config) error {
+	for _, f := range []struct {
+		name          string
+		proof, config any
+	}{
+		{"XXH128", p.XXH128, config.XXH128},
+		{"DomainSeperation", p.DomainSeperation, config.DomainSeperation},
+		{"SealRoot", p.SealRoot, config.SealRoot},
+		{"Arity", p.Config().arity(), config.arity()},
+	} {
+		if f.proof != f.config {
+			return &ConfigMismatchError{Field: f.name, Proof: f.proof, Config: f.config}
+		}
+	}
+
+	width := 8
+	if config.XXH128 {
+		width = 16
+	}
+	for level, sib := range p.Siblings {
+		if len(sib) != width {
+			return &SiblingLengthError{Level: level, Got: len(sib), Want: width}
+		}
+	}
+	if !p.checkOmitted(config.arity()) {
+		return ErrInvalidOmitted
+	}
+	return nil
 }
@@ -100,8 +100,18 @@ func TestVerify(t *testing.T) {
 
 		// Verify with wrong flag
 		ok, err := tree.Verify(input[0], tree.Root, proof, &Config{DomainSeperation: false})
-		require.NoError(t, err)
 		assert.False(t, ok, "should fail when domain separation flag doesn't match tree")
+		var mismatch *ConfigMismatchError
+		require.ErrorAs(t, err, &mismatch)
+		assert.Equal(t, &ConfigMismatchError{Field: "DomainSeperation", Proof: true, Config: false}, mismatch)
+		assert.ErrorIs(t, err, ErrConfigMismatch)
+
+		// A proof that doesn't record the flag still hashes differently
+		unrecorded := *proof
+		unrecorded.DomainSeperation = false
+		ok, err = tree.Verify(input[0], tree.Root, &unrecorded, &Config{DomainSeperation: false})
+		require.NoError(t, err)
+		assert.False(t, ok)
 	})
 
 	t.Run("input validation - nil cases", func(t *testing.T) {
@@ -134,4 +144,245 @@ func TestVerify(t *testing.T) {
 			assert.True(t, ok, "minimal tree verification failed for leaf %d", i)
 		}
 	})
+
+	t.Run("keyed tree requires matching seed and secret", func(t *testing.T) {
+		input := generateRandomInputs(t, 5)
+		cfg := &Config{XXH128: true, Seed: 7, Secret: []byte("s3cr3t")}
+		tree, err := New(cfg, input)
+		require.NoError(t, err)
+
+		proof, err := tree.ProofFromInput(input[3])
+		require.NoError(t, err)
+
+		ok, err := Verify(input[3], tree.Root, proof, cfg)
+		require.NoError(t, err)
+		assert.True(t, ok, "verification with the tree's key should succeed")
+
+		ok, err = Verify(input[3], tree.Root, proof, &Config{XXH128: true, Seed: 8, Secret: []byte("s3cr3t")})
+		require.NoError(t, err)
+		assert.False(t, ok, "verification with the wrong seed should fail")
+
+		ok, err = Verify(input[3], tree.Root, proof, &Config{XXH128: true, Seed: 7})
+		require.NoError(t, err)
+		assert.False(t, ok, "verification without the secret should fail")
+	})
+
+	t.Run("sealed root requires matching metadata", func(t *testing.T) {
+		input := generateRandomInputs(t, 5)
+		cfg := &Config{DomainSeperation: true, SealRoot: true}
+		tree, err := New(cfg, input)
+		require.NoError(t, err)
+
+		for i, data := range input {
+			proof, err := tree.ProofFromInput(data)
+			require.NoError(t, err)
+			assert.Equal(t, 5, proof.LeafCount)
+
+			ok, err := Verify(data, tree.Root, proof, cfg)
+			require.NoError(t, err)
+			assert.True(t, ok, "sealed verification failed for leaf %d", i)
+		}
+
+		proof, err := tree.ProofFromInput(input[0])
+		require.NoError(t, err)
+
+		// Same depth, different shape
+		replayed := *proof
+		replayed.LeafCount = 6
+		ok, err := Verify(input[0], tree.Root, &replayed, cfg)
+		require.NoError(t, err)
+		assert.False(t, ok, "should fail when the leaf count differs")
+
+		// Different hash width
+		ok, err = Verify(input[0], tree.Root, proof, &Config{DomainSeperation: true, SealRoot: true, XXH128: true})
+		assert.ErrorIs(t, err, ErrConfigMismatch)
+		assert.False(t, ok, "should fail when the hash width differs")
+
+		// Unsealed verification of a sealed root
+		ok, err = Verify(input[0], tree.Root, proof, &Config{DomainSeperation: true})
+		assert.ErrorIs(t, err, ErrConfigMismatch)
+		assert.False(t, ok, "should fail when the root is verified unsealed")
+
+		unsealed := *proof
+		unsealed.SealRoot = false
+		ok, err = Verify(input[0], tree.Root, &unsealed, &Config{DomainSeperation: true})
+		require.NoError(t, err)
+		assert.False(t, ok, "the metadata must be part of the sealed root")
+
+		missing := *proof
+		missing.LeafCount = 0
+		ok, err = Verify(input[0], tree.Root, &missing, cfg)
+		assert.False(t, ok)
+		assert.ErrorIs(t, err, ErrProofLeafCount)
+	})
+
+	t.Run("rejects indexes past the leaves", func(t *testing.T) {
+		input := generateRandomInputs(t, 5)
+		for _, cfg := range []*Config{{SealRoot: true}, {}} {
+			tree, err := New(cfg, input)
+			require.NoError(t, err)
+			proof, err := tree.Proof(4)
+			require.NoError(t, err)
+
+			// Index 5 and 7 hash along the same path as leaf 4.
+			for _, index := range []uint64{5, 7} {
+				claimed := *proof
+				claimed.Index = index
+				ok, err := Verify(input[4], tree.Root, &claimed, cfg)
+				assert.ErrorIs(t, err, ErrProofInvalidIndex, "index %d", index)
+				assert.False(t, ok)
+
+				ok, err = NewVerifier(tree.Root, cfg).Verify(input[4], &claimed)
+				assert.ErrorIs(t, err, ErrProofInvalidIndex, "index %d", index)
+				assert.False(t, ok)
+			}
+		}
+
+		// Without a leaf count, the index must still fit the proof's depth.
+		tree, err := New(nil, input)
+		require.NoError(t, err)
+		proof, err := tree.Proof(4)
+		require.NoError(t, err)
+		proof.LeafCount = 0
+		ok, err := Verify(input[4], tree.Root, proof, nil)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		proof.Index = 4 + 8
+		ok, err = Verify(input[4], tree.Root, proof, nil)
+		assert.ErrorIs(t, err, ErrProofInvalidIndex)
+		assert.False(t, ok)
+		_, err = NewVerifier(tree.Root, nil).Verify(input[4], proof)
+		assert.ErrorIs(t, err, ErrProofInvalidIndex)
+	})
+
+	t.Run("uses the proof's config when none is given", func(t *testing.T) {
+		input := generateRandomInputs(t, 6)
+		tree, err := New(&Config{XXH128: true, DomainSeperation: true, SealRoot: true}, input)
+		require.NoError(t, err)
+
+		proof, err := tree.Proof(3)
+		require.NoError(t, err)
+		assert.Equal(t, tree.Config, proof.Config())
+
+		ok, err := Verify(input[3], tree.Root, proof, nil)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("rejects siblings of the wrong width", func(t *testing.T) {
+		input := generateRandomInputs(t, 4)
+		tree, err := New(nil, input)
+		require.NoError(t, err)
+
+		proof, err := tree.Proof(2)
+		require.NoError(t, err)
+		proof.Siblings[1] = append(proof.Siblings[1], 0)
+
+		ok, err := Verify(input[2], tree.Root, proof, nil)
+		assert.False(t, ok)
+		var length *SiblingLengthError
+		require.ErrorAs(t, err, &length)
+		assert.Equal(t, &SiblingLengthError{Level: 1, Got: 9, Want: 8}, length)
+		assert.ErrorIs(t, err, ErrSiblingLength)
+	})
+}
+
+func TestVerifyDetailed(t *testing.T) {
+	t.Parallel()
+
+	input := generateRandomInputs(t, 5)
+	cfg := &Config{DomainSeperation: true}
+	tree, err := New(cfg, input)
+	require.NoError(t, err)
+
+	t.Run("reports the path of a valid proof", func(t *testing.T) {
+		proof, err := tree.Proof(4)
+		require.NoError(t, err)
+
+		res, err := VerifyDetailed(input[4], tree.Root, proof, cfg)
+		require.NoError(t, err)
+		assert.True(t, res.OK())
+		assert.Equal(t, VerifyOK, res.Reason)
+		assert.NoError(t, res.Err)
+		assert.Equal(t, tree.Root, res.Root)
+
+		require.Len(t, res.Levels, tree.Depth+1)
+		assert.Equal(t, tree.Leaves[4], res.Levels[0])
+		for level := 1; level < tree.Depth; level++ {
+			want, err := tree.nodeAt(level, 4>>level)
+			require.NoError(t, err)
+			assert.Equal(t, want, res.Levels[level], "level %d", level)
+		}
+		assert.Equal(t, []byte(tree.Root), res.Levels[tree.Depth])
+	})
+
+	t.Run("classifies failures", func(t *testing.T) {
+		proof, err := tree.Proof(1)
+		require.NoError(t, err)
+
+		shallow := *proof
+		shallow.Siblings = proof.Siblings[:2]
+
+		short := *proof
+		short.Siblings = append([][]byte{proof.Siblings[0][:4]}, proof.Siblings[1:]...)
+
+		tests := []struct {
+			name   string
+			input  []byte
+			proof  *Proof
+			config *Config
+			reason VerifyReason
+			err    error
+		}{
+			{"root mismatch", input[2], proof, cfg, VerifyRootMismatch, ErrRootMismatch},
+			{"sibling length", input[1], &short, cfg, VerifySiblingLength, ErrSiblingLength},
+			{"depth mismatch", input[1], &shallow, cfg, VerifyDepthMismatch, ErrDepthMismatch},
+			{"config mismatch", input[1], proof, &Config{DomainSeperation: true, XXH128: true}, VerifyConfigMismatch, ErrConfigMismatch},
+		}
+		for _, tt := range tests {
+			res, err := VerifyDetailed(tt.input, tree.Root, tt.proof, tt.config)
+			require.NoError(t, err, tt.name)
+			assert.False(t, res.OK(), tt.name)
+			assert.Equal(t, tt.reason, res.Reason, tt.name)
+			assert.ErrorIs(t, res.Err, tt.err, tt.name)
+		}
+	})
+
+	t.Run("records the root it recomputed", func(t *testing.T) {
+		proof, err := tree.Proof(0)
+		require.NoError(t, err)
+
+		res, err := VerifyDetailed(input[3], tree.Root, proof, cfg)
+		require.NoError(t, err)
+		assert.Equal(t, VerifyRootMismatch, res.Reason)
+		assert.Equal(t, []byte(res.Root), res.Levels[len(res.Levels)-1])
+		assert.NotEqual(t, tree.Root, res.Root)
+		assert.Contains(t, res.Err.Error(), res.Root.String())
+	})
+
+	t.Run("returns argument errors", func(t *testing.T) {
+		_, err := VerifyDetailed(nil, tree.Root, &Proof{}, cfg)
+		assert.ErrorIs(t, err, ErrInputIsNil)
+		_, err = VerifyDetailed(input[0], tree.Root, nil, cfg)
+		assert.ErrorIs(t, err, ErrProofIsNil)
+	})
+}
+
+func TestWrappedErrors(t *testing.T) {
+	t.Parallel()
+
+	tree, err := New(nil, generateRandomInputs(t, 3))
+	require.NoError(t, err)
+
+	_, err = tree.Proof(7)
+	assert.ErrorIs(t, err, ErrProofInvalidIndex)
+	assert.EqualError(t, err, "leaf index is out of range: 7 not in [0, 3)")
+
+	err = tree.Update(-1, []byte("x"))
+	assert.ErrorIs(t, err, ErrProofInvalidIndex)
+
+	_, err = New(nil, nil)
+	assert.ErrorIs(t, err, ErrInvalidNumOfLeaves)
+	assert.Contains(t, err.Error(), "got 0")
 }